@@ -0,0 +1,264 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/webability-go/xcore/v2"
+)
+
+// XConfigCollection is a list of sub XConfig, built by the repeated [[section]] blocks or the key[N].param keys:
+//  [[server]]
+//  host=alpha.local
+//  weight=2
+//
+//  [[server]]
+//  host=beta.local
+// It implements xcore.XDatasetCollectionDef, so it is returned by GetCollection and can be used into the templates loops.
+type XConfigCollection []*XConfig
+
+// Unshift will add the XConfig at the beginning of the collection. Only *XConfig values are accepted, other datasets are ignored
+func (l *XConfigCollection) Unshift(data xcore.XDatasetDef) {
+	if c, ok := data.(*XConfig); ok {
+		*l = append(XConfigCollection{c}, *l...)
+	}
+}
+
+// Shift will remove the first XConfig of the collection and return it, or nil if the collection is empty
+func (l *XConfigCollection) Shift() xcore.XDatasetDef {
+	if len(*l) == 0 {
+		return nil
+	}
+	c := (*l)[0]
+	*l = (*l)[1:]
+	return c
+}
+
+// Push will add the XConfig at the end of the collection. Only *XConfig values are accepted, other datasets are ignored
+func (l *XConfigCollection) Push(data xcore.XDatasetDef) {
+	if c, ok := data.(*XConfig); ok {
+		*l = append(*l, c)
+	}
+}
+
+// Pop will remove the last XConfig of the collection and return it, or nil if the collection is empty
+func (l *XConfigCollection) Pop() xcore.XDatasetDef {
+	if len(*l) == 0 {
+		return nil
+	}
+	c := (*l)[len(*l)-1]
+	*l = (*l)[:len(*l)-1]
+	return c
+}
+
+// Count will return the number of XConfig into the collection
+func (l *XConfigCollection) Count() int {
+	return len(*l)
+}
+
+// Get will return the XConfig at the index position of the collection
+// return false as second parameter if the index is out of range
+func (l *XConfigCollection) Get(index int) (xcore.XDatasetDef, bool) {
+	if index < 0 || index >= len(*l) {
+		return nil, false
+	}
+	return (*l)[index], true
+}
+
+// GetData will return the value of the key entry of the last XConfig of the collection that contains it
+func (l *XConfigCollection) GetData(key string) (interface{}, bool) {
+	for i := len(*l) - 1; i >= 0; i-- {
+		if value, ok := (*l)[i].Get(key); ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// GetDataString will return the value of the key entry as a string (see GetData)
+func (l *XConfigCollection) GetDataString(key string) (string, bool) {
+	for i := len(*l) - 1; i >= 0; i-- {
+		if value, ok := (*l)[i].GetString(key); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// GetDataBool will return the value of the key entry as a boolean (see GetData)
+func (l *XConfigCollection) GetDataBool(key string) (bool, bool) {
+	for i := len(*l) - 1; i >= 0; i-- {
+		if value, ok := (*l)[i].GetBool(key); ok {
+			return value, true
+		}
+	}
+	return false, false
+}
+
+// GetDataInt will return the value of the key entry as an int (see GetData)
+func (l *XConfigCollection) GetDataInt(key string) (int, bool) {
+	for i := len(*l) - 1; i >= 0; i-- {
+		if value, ok := (*l)[i].GetInt(key); ok {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// GetDataFloat will return the value of the key entry as a float64 (see GetData)
+func (l *XConfigCollection) GetDataFloat(key string) (float64, bool) {
+	for i := len(*l) - 1; i >= 0; i-- {
+		if value, ok := (*l)[i].GetFloat(key); ok {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// GetDataTime will return the value of the key entry as a time (see GetData)
+func (l *XConfigCollection) GetDataTime(key string) (time.Time, bool) {
+	for i := len(*l) - 1; i >= 0; i-- {
+		if value, ok := (*l)[i].GetTime(key); ok {
+			return value, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// GetCollection will return the value of the key entry as a collection (see GetData)
+func (l *XConfigCollection) GetCollection(key string) (xcore.XDatasetCollectionDef, bool) {
+	for i := len(*l) - 1; i >= 0; i-- {
+		if value, ok := (*l)[i].GetCollection(key); ok {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// Clone will perform a full clone of the collection and its XConfig
+func (l *XConfigCollection) Clone() xcore.XDatasetCollectionDef {
+	cloned := make(XConfigCollection, 0, len(*l))
+	for _, c := range *l {
+		cloned = append(cloned, c.Clone().(*XConfig))
+	}
+	return &cloned
+}
+
+// String will create a string of the content of the collection
+func (l *XConfigCollection) String() string {
+	sdata := []string{}
+	for _, c := range *l {
+		sdata = append(sdata, c.String())
+	}
+	return "XConfigCollection[\n" + strings.Join(sdata, "") + "]\n"
+}
+
+// GoString will create a string of the content of the collection (based on String)
+func (l *XConfigCollection) GoString() string {
+	return "#" + l.String()
+}
+
+// splitindex separates the key and the index of a key[N] path element
+func splitindex(key string) (string, int, bool) {
+	pos := strings.Index(key, "[")
+	if pos <= 0 || key[len(key)-1] != ']' {
+		return key, 0, false
+	}
+	index, err := strconv.Atoi(key[pos+1 : len(key)-1])
+	if err != nil || index < 0 || strings.HasPrefix(key[pos+1:], "+") {
+		return key, 0, false
+	}
+	return strings.TrimSpace(key[:pos]), index, true
+}
+
+// collection returns the collection of the key entry, creating it if create is true and it does not exist yet
+func (c *XConfig) collection(key string, create bool) (*XConfigCollection, error) {
+	if val, ok := c.Parameters[key]; ok {
+		if l, ok := val.Value.(*XConfigCollection); ok {
+			return l, nil
+		}
+		return nil, errors.New("The parameter " + key + " already exists and is not a collection of XConfig")
+	}
+	if !create {
+		return nil, ErrNotFound
+	}
+	p := newParam()
+	p.add(22, &XConfigCollection{}, 0, nil)
+	c.Parameters[key] = *p
+	c.Order = append(c.Order, key)
+	return p.Value.(*XConfigCollection), nil
+}
+
+// element returns the XConfig at the index of the collection of the key entry.
+// If create is true, the index can be the size of the collection to add a new XConfig at the end
+func (c *XConfig) element(key string, index int, create bool) (*XConfig, error) {
+	l, err := c.collection(key, create && index == 0)
+	if err != nil {
+		if err == ErrNotFound && create {
+			return nil, fmt.Errorf("The index %d of %s is out of range", index, key)
+		}
+		return nil, err
+	}
+	if index < len(*l) {
+		return (*l)[index], nil
+	}
+	if !create {
+		return nil, ErrNotFound
+	}
+	if index > len(*l) {
+		return nil, fmt.Errorf("The index %d of %s is out of range", index, key)
+	}
+	sub, _, err := c.appendelement(key)
+	return sub, err
+}
+
+// appendelement adds a new XConfig at the end of the collection of the key entry (a dotted path), creating the collection if needed.
+// It returns the new XConfig and its index into the collection
+func (c *XConfig) appendelement(path string) (*XConfig, int, error) {
+	config := c
+	key := path
+	if pos := strings.LastIndex(path, "."); pos >= 0 {
+		var err error
+		config, err = c.subconfigpath(path[:pos])
+		if err != nil {
+			return nil, 0, err
+		}
+		key = strings.TrimSpace(path[pos+1:])
+	}
+	l, err := config.collection(key, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	sub := New()
+	sub.parent = config
+	*l = append(*l, sub)
+	return sub, len(*l) - 1, nil
+}
+
+// locateelement returns the collection and the index of the dotted path when its last key is an element of a collection (server[1])
+func (c *XConfig) locateelement(path string) (*XConfigCollection, int, bool) {
+	prefix, last := "", path
+	if pos := strings.LastIndex(path, "."); pos >= 0 {
+		prefix, last = path[:pos+1], path[pos+1:]
+	}
+	name, index, ok := splitindex(last)
+	if !ok {
+		return nil, 0, false
+	}
+	config, key, ok := c.locate(prefix + name)
+	if !ok {
+		return nil, 0, false
+	}
+	l, ok := config.Parameters[key].Value.(*XConfigCollection)
+	if !ok || index >= len(*l) {
+		return nil, 0, false
+	}
+	return l, index, true
+}
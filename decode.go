@@ -0,0 +1,283 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// FieldError is the error of one field of the structure filled by Decode
+type FieldError struct {
+	// Field is the path of the field into the structure (Database.Host)
+	Field string
+	// Key is the dotted path of the parameter into the XConfig (database.host)
+	Key string
+	// Err is the cause of the error (ErrNotFound for a required parameter, *TypeError, *ConversionError...)
+	Err error
+}
+
+// Error will create the message of the error
+func (e *FieldError) Error() string {
+	return "The field " + e.Field + " (parameter " + e.Key + "): " + e.Err.Error()
+}
+
+// Unwrap will return the cause of the error
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError is the error returned by Decode and Unmarshal, with the errors of all the fields that could not be filled
+type DecodeError struct {
+	Errors []*FieldError
+}
+
+// Error will create the message of the error, one line for each field
+func (e *DecodeError) Error() string {
+	msgs := []string{}
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Unmarshal will parse the configuration data and fill the structure pointed by v with it, see Decode
+func Unmarshal(data []byte, v interface{}) error {
+	c := New()
+	if err := c.LoadString(string(data)); err != nil {
+		return err
+	}
+	return c.Decode(v)
+}
+
+// Decode will fill the structure pointed by v with the parameters of the XConfig.
+//
+// The parameter of each field is given by the xconfig tag, as a dotted path relative to the XConfig of the structure.
+// Without a tag, the name of the field is used, case insensitive. The "-" tag ignores the field, and the required option
+// reports an error if the parameter does not exist:
+//  type Settings struct {
+//    Host    string        `xconfig:"database.host,required"`
+//    Timeout time.Duration `xconfig:"timeout"`
+//    Ignored string        `xconfig:"-"`
+//  }
+// The nested structures and the maps of strings are filled from the sub XConfig, the slices from the arrays of values
+// (or from the collections of XConfig for the slices of structures),
+// and the types implementing encoding.TextUnmarshaler from the strings. The values are converted with the same rules as the Get*E functions.
+// The fields without parameter keep their value, so the structure can be prefilled with the default values.
+//
+// All the fields are decoded, and the errors are returned together as a *DecodeError.
+func (c *XConfig) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("The decode target must be a non nil pointer to a struct")
+	}
+	errs := []*FieldError{}
+	c.decodestruct(rv.Elem(), "", "", &errs)
+	if len(errs) > 0 {
+		return &DecodeError{Errors: errs}
+	}
+	return nil
+}
+
+// decodestruct fills the fields of the structure, field and prefix are the paths of the structure into the root structure and XConfig
+func (c *XConfig) decodestruct(rv reflect.Value, field string, prefix string, errs *[]*FieldError) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag := sf.Tag.Get("xconfig")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if pos := strings.Index(tag, ","); pos >= 0 {
+			name, options = tag[:pos], tag[pos+1:]
+		}
+		embedded := name == "" && sf.Anonymous && sf.Type.Kind() == reflect.Struct
+		if sf.PkgPath != "" && !embedded {
+			// not exported, the fields of an embedded structure may be exported
+			continue
+		}
+		fieldpath := field + sf.Name
+		fv := rv.Field(i)
+		if embedded {
+			// the embedded structures share the XConfig of the structure
+			c.decodestruct(fv, field, prefix, errs)
+			continue
+		}
+		key := name
+		if key == "" {
+			key = c.fieldkey(sf.Name)
+		}
+		value, err := c.lookup(key)
+		if err == ErrNotFound {
+			if strings.Contains(","+options+",", ",required,") {
+				*errs = append(*errs, &FieldError{Field: fieldpath, Key: prefix + key, Err: ErrNotFound})
+			} else if fv.Kind() == reflect.Struct && !reflect.PtrTo(fv.Type()).Implements(textUnmarshalerType) {
+				// reports the required fields of a missing sub XConfig
+				New().decodestruct(fv, fieldpath+".", prefix+key+".", errs)
+			}
+			continue
+		}
+		if err == nil {
+			err = decodevalue(value, fv, fieldpath, prefix+key, errs)
+		}
+		if err != nil {
+			*errs = append(*errs, &FieldError{Field: fieldpath, Key: prefix + key, Err: err})
+		}
+	}
+}
+
+// fieldkey returns the key of the parameter matching the name of the field, case insensitive
+func (c *XConfig) fieldkey(name string) string {
+	if _, ok := c.Parameters[name]; ok {
+		return name
+	}
+	for _, key := range c.Order {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
+
+// decodevalue fills rv with the value of the parameter key.
+// The errors of the fields of the nested structures are added to errs, the error of rv itself is returned
+func decodevalue(value interface{}, rv reflect.Value, field string, key string, errs *[]*FieldError) error {
+	if value != nil && reflect.TypeOf(value).AssignableTo(rv.Type()) {
+		if rv.Kind() == reflect.Slice {
+			// the arrays of the XConfig are not shared with the structure
+			rv.Set(reflect.AppendSlice(reflect.MakeSlice(rv.Type(), 0, reflect.ValueOf(value).Len()), reflect.ValueOf(value)))
+		} else {
+			rv.Set(reflect.ValueOf(value))
+		}
+		return nil
+	}
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return decodevalue(value, rv.Elem(), field, key, errs)
+	}
+	if reflect.PtrTo(rv.Type()).Implements(textUnmarshalerType) {
+		str, ok := value.(string)
+		if !ok {
+			return &TypeError{Key: key, Expected: "string", Actual: typename(value)}
+		}
+		return rv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(str))
+	}
+	expected := rv.Type().String()
+	switch rv.Kind() {
+	case reflect.Struct:
+		sub, ok := value.(*XConfig)
+		if !ok {
+			return &TypeError{Key: key, Expected: "XConfig", Actual: typename(value)}
+		}
+		sub.decodestruct(rv, field+".", key+".", errs)
+	case reflect.Map:
+		sub, ok := value.(*XConfig)
+		if !ok || rv.Type().Key().Kind() != reflect.String {
+			return &TypeError{Key: key, Expected: expected, Actual: typename(value)}
+		}
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		for _, k := range sub.Keys() {
+			v, err := sub.lookup(k)
+			if err == nil {
+				elem := reflect.New(rv.Type().Elem()).Elem()
+				err = decodevalue(v, elem, field+"["+k+"]", key+"."+k, errs)
+				if err == nil {
+					rv.SetMapIndex(reflect.ValueOf(k).Convert(rv.Type().Key()), elem)
+				}
+			}
+			if err != nil {
+				*errs = append(*errs, &FieldError{Field: field + "[" + k + "]", Key: key + "." + k, Err: err})
+			}
+		}
+	case reflect.Slice:
+		values := reflect.ValueOf(value)
+		l, collection := value.(*XConfigCollection)
+		if collection {
+			values = reflect.ValueOf([]*XConfig(*l))
+		} else if values.Kind() != reflect.Slice {
+			// a single value is an array of 1 value
+			values = reflect.ValueOf([]interface{}{value})
+		}
+		slice := reflect.MakeSlice(rv.Type(), values.Len(), values.Len())
+		for i := 0; i < values.Len(); i++ {
+			elementkey := key
+			if collection {
+				elementkey = fmt.Sprintf("%s[%d]", key, i)
+			}
+			err := decodevalue(values.Index(i).Interface(), slice.Index(i), fmt.Sprintf("%s[%d]", field, i), elementkey, errs)
+			if err != nil {
+				return err
+			}
+		}
+		rv.Set(slice)
+	case reflect.Interface:
+		if value != nil && !reflect.TypeOf(value).Implements(rv.Type()) {
+			return &TypeError{Key: key, Expected: expected, Actual: typename(value)}
+		}
+		rv.Set(reflect.ValueOf(value))
+	case reflect.String:
+		str, ok := value.(string)
+		if !ok {
+			return &TypeError{Key: key, Expected: expected, Actual: typename(value)}
+		}
+		rv.SetString(str)
+	case reflect.Bool:
+		b, err := tobool(key, value)
+		if err != nil {
+			return err
+		}
+		rv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if str, ok := value.(string); ok && rv.Type() == reflect.TypeOf(time.Duration(0)) {
+			// a duration built by a reference
+			d, err := time.ParseDuration(str)
+			if err != nil {
+				return err
+			}
+			rv.SetInt(int64(d))
+			return nil
+		}
+		i, err := toint64(key, value, expected)
+		if err != nil {
+			return err
+		}
+		if rv.OverflowInt(i) {
+			return &ConversionError{Key: key, Value: value, Expected: expected, Err: ErrOverflow}
+		}
+		rv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := touint64(key, value, expected)
+		if err != nil {
+			return err
+		}
+		if rv.OverflowUint(u) {
+			return &ConversionError{Key: key, Value: value, Expected: expected, Err: ErrOverflow}
+		}
+		rv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := tofloat64(key, value, expected)
+		if err != nil {
+			return err
+		}
+		if rv.OverflowFloat(f) {
+			return &ConversionError{Key: key, Value: value, Expected: expected, Err: ErrOverflow}
+		}
+		rv.SetFloat(f)
+	default:
+		return &TypeError{Key: key, Expected: expected, Actual: typename(value)}
+	}
+	return nil
+}
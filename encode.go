@@ -0,0 +1,256 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"encoding"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// FromStruct will build a XConfig with the fields of the structure v (or pointer to a structure), the reverse of Decode.
+//
+// The fields are read with the same xconfig tags as Decode, and the omitempty option skips the fields with a zero value.
+// The nested structures and the maps of strings become sub XConfig, the slices become arrays of values,
+// and the slices of structures become collections of XConfig.
+// The doc tag of a field is written as a comment before its parameter, so Marshal builds a commented template file:
+//  type Settings struct {
+//    Host string `xconfig:"database.host" doc:"The host of the database server"`
+//    Port int    `xconfig:"database.port,omitempty"`
+//  }
+//  config, err := xconfig.FromStruct(Settings{Host: "localhost"})
+//  fmt.Print(config.Marshal())
+// The fields that cannot be written as a parameter return a *FieldError.
+func FromStruct(v interface{}) (*XConfig, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, errors.New("The FromStruct function only accept a struct or a pointer to a struct")
+	}
+	c := New()
+	if err := c.encodestruct(rv, "", ""); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// encodestruct adds the fields of the structure as parameters, field and prefix are the paths of the structure into the root structure and XConfig
+func (c *XConfig) encodestruct(rv reflect.Value, field string, prefix string) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag := sf.Tag.Get("xconfig")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if pos := strings.Index(tag, ","); pos >= 0 {
+			name, options = tag[:pos], tag[pos+1:]
+		}
+		embedded := name == "" && sf.Anonymous && sf.Type.Kind() == reflect.Struct
+		if sf.PkgPath != "" && !embedded {
+			// not exported, the fields of an embedded structure may be exported
+			continue
+		}
+		fv := rv.Field(i)
+		if embedded {
+			// the embedded structures share the XConfig of the structure
+			if err := c.encodestruct(fv, field, prefix); err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.Contains(","+options+",", ",omitempty,") && fv.IsZero() {
+			continue
+		}
+		key := name
+		if key == "" {
+			key = sf.Name
+		}
+		if doc := sf.Tag.Get("doc"); doc != "" {
+			if err := c.adddoc(key, doc); err != nil {
+				return &FieldError{Field: field + sf.Name, Key: prefix + key, Err: err}
+			}
+		}
+		if err := c.encodevalue(key, fv, field+sf.Name, prefix+key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adddoc adds the lines of the documentation as comments into the XConfig of the key (a dotted path)
+func (c *XConfig) adddoc(key string, doc string) error {
+	config := c
+	if pos := strings.LastIndex(key, "."); pos >= 0 {
+		var err error
+		config, err = c.subconfigpath(key[:pos])
+		if err != nil {
+			return err
+		}
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		config.addcomment(len(config.Order)+1, strings.TrimRight("# "+line, " "))
+	}
+	return nil
+}
+
+// encodevalue adds the value of the field as the parameter key
+func (c *XConfig) encodevalue(key string, rv reflect.Value, field string, path string) error {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			// no value to write
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if value, ok := scalar(rv); ok {
+		if err := c.Add(key, value); err != nil {
+			return &FieldError{Field: field, Key: path, Err: err}
+		}
+		return nil
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		sub := New()
+		if err := sub.encodestruct(rv, field+".", path+"."); err != nil {
+			return err
+		}
+		// a sub XConfig already created by a dotted key is merged
+		if err := c.addparam(0, key, 21, sub, 0, nil); err != nil {
+			return &FieldError{Field: field, Key: path, Err: err}
+		}
+		return nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		keys := []string{}
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		sub := New()
+		for _, k := range keys {
+			err := sub.encodevalue(k, rv.MapIndex(reflect.ValueOf(k).Convert(rv.Type().Key())), field+"["+k+"]", path+"."+k)
+			if err != nil {
+				return err
+			}
+		}
+		// a sub XConfig already created by a dotted key is merged
+		if err := c.addparam(0, key, 21, sub, 0, nil); err != nil {
+			return &FieldError{Field: field, Key: path, Err: err}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if rv.Len() == 0 {
+			if err := c.setparam(0, key, 10, []interface{}{}, 0, nil); err != nil {
+				return &FieldError{Field: field, Key: path, Err: err}
+			}
+			return nil
+		}
+		if structs(rv) {
+			// the structures are written as a collection of XConfig
+			l := XConfigCollection{}
+			for i := 0; i < rv.Len(); i++ {
+				sub := New()
+				elem := reflect.Indirect(rv.Index(i))
+				if err := sub.encodestruct(elem, field+"["+strconv.Itoa(i)+"].", path+"["+strconv.Itoa(i)+"]."); err != nil {
+					return err
+				}
+				l = append(l, sub)
+			}
+			if err := c.addparam(0, key, 22, &l, 0, nil); err != nil {
+				return &FieldError{Field: field, Key: path, Err: err}
+			}
+			return nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			elem := rv.Index(i)
+			for elem.Kind() == reflect.Ptr || elem.Kind() == reflect.Interface {
+				elem = elem.Elem()
+			}
+			value, ok := scalar(elem)
+			if !ok {
+				return &FieldError{Field: field + "[" + strconv.Itoa(i) + "]", Key: path, Err: &TypeError{Key: path, Expected: "parameter value", Actual: rv.Index(i).Type().String()}}
+			}
+			if err := c.Add(key, value); err != nil {
+				return &FieldError{Field: field + "[" + strconv.Itoa(i) + "]", Key: path, Err: err}
+			}
+		}
+		return nil
+	}
+	return &FieldError{Field: field, Key: path, Err: &TypeError{Key: path, Expected: "parameter value", Actual: rv.Type().String()}}
+}
+
+// scalar returns the value of the field as a value of a parameter (string, int, int64, uint64, float64, bool, time or duration)
+func scalar(rv reflect.Value) (interface{}, bool) {
+	if !rv.IsValid() {
+		return nil, false
+	}
+	switch v := rv.Interface().(type) {
+	case time.Time:
+		return v, true
+	case time.Duration:
+		return v, true
+	}
+	if rv.Type().Implements(textMarshalerType) {
+		text, err := rv.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, false
+		}
+		return string(text), true
+	}
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), true
+	case reflect.Bool:
+		return rv.Bool(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// the integers are kept as int when they fit, as the parser does
+		_, value := integer(rv.Int())
+		return value, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() <= uint64(maxInt) {
+			return int(rv.Uint()), true
+		}
+		if rv.Uint() <= uint64(1<<63-1) {
+			return int64(rv.Uint()), true
+		}
+		return rv.Uint(), true
+	case reflect.Float32:
+		// keeps the shortest decimal representation of the float32 (0.1 and not 0.10000000149011612)
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(rv.Float(), 'g', -1, 32), 64)
+		return f, true
+	case reflect.Float64:
+		return rv.Float(), true
+	}
+	return nil, false
+}
+
+// structs returns true if the elements of the slice are structures (or pointers to structures) that are not written as a single value
+func structs(rv reflect.Value) bool {
+	t := rv.Type().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) || t.Implements(textMarshalerType) {
+		return false
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if rv.Index(i).Kind() == reflect.Ptr && rv.Index(i).IsNil() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,237 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"errors"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvOptions are the options of LoadEnv and EnvDoc
+type EnvOptions struct {
+	// Separator separates the keys of the sub XConfig into the name of the variable, "__" by default: APP_DATABASE__HOST is database.host
+	Separator string
+	// ListSeparator separates the values of the arrays, "," by default: APP_HOSTS=a,b,c
+	ListSeparator string
+	// Strict makes LoadEnv fail when a variable with the prefix does not match an existing parameter
+	Strict bool
+}
+
+// defaults returns the options with the default separators
+func (opts EnvOptions) defaults() EnvOptions {
+	if opts.Separator == "" {
+		opts.Separator = "__"
+	}
+	if opts.ListSeparator == "" {
+		opts.ListSeparator = ","
+	}
+	return opts
+}
+
+// envprefix returns the prefix of the variables, ended with a _
+func envprefix(prefix string) string {
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+	return prefix
+}
+
+// envname returns the name of a key into a variable name: uppercase, the characters other than letters and digits are replaced by _
+func envname(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// LoadEnv will load the environment variables starting with the prefix into the XConfig, replacing the values as LoadXConfig does.
+// The name of the variable without the prefix is the path of the parameter, with the Separator between the keys of the sub XConfig,
+// and the index of an element of a collection as a key of its own:
+//  APP_PORT=8080                 // port
+//  APP_DATABASE__HOST=db.local   // database.host
+//  APP_SERVER__0__HOST=alpha     // server[0].host
+//  APP_HOSTS=a,b,c               // hosts, if hosts is an array
+// The names are matched with the existing keys without case, and the new keys are lowercase.
+// The values are typed as into a config file (integer, float, boolean, time, duration or string), and the value of an array parameter is split on the ListSeparator.
+// A variable that matches a sub XConfig or a collection, or with an empty key (APP_A____B), is an error and nothing is loaded.
+// With the Strict option, a variable that does not match an existing parameter is an error and nothing is loaded.
+// If a value cannot be loaded, the XConfig is not changed.
+func (c *XConfig) LoadEnv(prefix string, opts EnvOptions) error {
+	opts = opts.defaults()
+	prefix = envprefix(prefix)
+	vars := map[string]string{}
+	names := []string{}
+	for _, env := range os.Environ() {
+		pos := strings.Index(env, "=")
+		if pos <= len(prefix) || !strings.HasPrefix(env, prefix) {
+			continue
+		}
+		vars[env[:pos]] = env[pos+1:]
+		names = append(names, env[:pos])
+	}
+	sort.Strings(names)
+
+	// the variables are checked before any value is loaded
+	keys := []string{}
+	for _, name := range names {
+		parts := strings.Split(name[len(prefix):], opts.Separator)
+		for _, part := range parts {
+			if part == "" {
+				return &ParseError{File: name, Err: errors.New("The environment variable has an empty key")}
+			}
+		}
+		key, exists := c.envpath(parts)
+		if c.isnode(key) {
+			return &ParseError{File: name, Key: key, Err: errors.New("The environment variable matches a sub XConfig or a collection, not a value")}
+		}
+		if opts.Strict && !exists {
+			return &ParseError{File: name, Key: key, Err: errors.New("The environment variable does not match any parameter")}
+		}
+		keys = append(keys, key)
+	}
+	// the variables are loaded into a copy, so an error does not leave the XConfig half loaded
+	data := c.Clone().(*XConfig)
+	for i, name := range names {
+		meta := []valuemeta{{origin: Origin{File: name, Operation: "env"}}}
+		value := vars[name]
+		array := c.isarray(keys[i])
+		list := []string{value}
+		if array {
+			list = strings.Split(value, opts.ListSeparator)
+			if strings.TrimSpace(value) == "" {
+				list = nil
+			}
+		}
+		types := []int{}
+		values := []interface{}{}
+		for _, v := range list {
+			typeparam, v := infervalue(strings.TrimSpace(v))
+			types = append(types, typeparam)
+			values = append(values, v)
+		}
+		if err := data.overlay(keys[i], array, types, values, meta); err != nil {
+			return &ParseError{File: name, Key: keys[i], Text: value, Err: err}
+		}
+	}
+	c.adopt(data)
+	c.Multiple = true
+	return nil
+}
+
+// adopt replaces the parameters of the XConfig by the ones of data, a modified clone of the XConfig
+func (c *XConfig) adopt(data *XConfig) {
+	c.Parameters = data.Parameters
+	c.Comments = data.Comments
+	c.Order = data.Order
+	c.Multiple = data.Multiple
+	for _, v := range c.Parameters {
+		c.attach(v.Value)
+	}
+}
+
+// overlay replaces the value of the key entry (a dotted path) as a load does, or all its values if array is true
+func (c *XConfig) overlay(key string, array bool, types []int, values []interface{}, meta []valuemeta) error {
+	if !array {
+		return c.setparam(0, key, types[0], values[0], 0, meta)
+	}
+	// the parameter stays an array even with only one value
+	if err := c.setparam(0, key, 10, []interface{}{}, 0, nil); err != nil {
+		return err
+	}
+	for i, value := range values {
+		if err := c.addparam(0, key, types[i], value, 0, meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isarray returns true if the key entry (a dotted path) exists and is an array
+func (c *XConfig) isarray(path string) bool {
+	config, key, ok := c.locate(path)
+	if !ok {
+		return false
+	}
+	paramtype := config.Parameters[key].paramtype
+	return paramtype >= 10 && paramtype < 20
+}
+
+// isnode returns true if the key entry (a dotted path) is a sub XConfig, a collection or an element of a collection
+func (c *XConfig) isnode(path string) bool {
+	if _, _, ok := c.locateelement(path); ok {
+		return true
+	}
+	config, key, ok := c.locate(path)
+	return ok && config.Parameters[key].paramtype > 20
+}
+
+// envpath returns the dotted path of the parameter for the keys of a variable name.
+// It returns true as second parameter if the path is an existing value (not a sub XConfig)
+func (c *XConfig) envpath(names []string) (string, bool) {
+	path := []string{}
+	config := c
+	exists := true
+	for i := 0; i < len(names); i++ {
+		key := ""
+		if config != nil {
+			for _, k := range config.Order {
+				if k[0] != '#' && envname(k) == names[i] {
+					key = k
+					break
+				}
+			}
+		}
+		if key == "" {
+			exists = false
+			config = nil
+			path = append(path, strings.ToLower(names[i]))
+			continue
+		}
+		var next *XConfig
+		switch v := config.Parameters[key].Value.(type) {
+		case *XConfig:
+			next = v
+		case *XConfigCollection:
+			// the next name is the index of the element
+			if i+1 < len(names) {
+				if index, err := strconv.Atoi(names[i+1]); err == nil && index >= 0 && index < len(*v) {
+					key += "[" + names[i+1] + "]"
+					next = (*v)[index]
+					i++
+				}
+			}
+		}
+		path = append(path, key)
+		config = next
+	}
+	return strings.Join(path, "."), exists && config == nil
+}
+
+// EnvDoc will return the names of the environment variables LoadEnv accepts for the parameters of the XConfig, in their order (see FlatKeys)
+func (c *XConfig) EnvDoc(prefix string, opts EnvOptions) []string {
+	opts = opts.defaults()
+	prefix = envprefix(prefix)
+	names := []string{}
+	for _, path := range c.FlatKeys() {
+		keys := []string{}
+		for _, key := range strings.Split(path, ".") {
+			if name, index, ok := splitindex(key); ok {
+				keys = append(keys, envname(name), strconv.Itoa(index))
+				continue
+			}
+			keys = append(keys, envname(key))
+		}
+		names = append(names, prefix+strings.Join(keys, opts.Separator))
+	}
+	return names
+}
@@ -0,0 +1,109 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseError is the error returned by the Load* and Merge* functions when the configuration cannot be parsed.
+// It locates the offending line into the source, and can be retrieved with errors.As.
+type ParseError struct {
+	// File is the name of the parsed file, empty when the source is a string
+	File string
+	// Line is the line number into the source, starting at 1 (0 if unknown)
+	Line int
+	// Column is the column of the offending text into the line, starting at 1 (0 if unknown)
+	Column int
+	// Key is the key of the parameter, if any
+	Key string
+	// Text is the offending text, if any
+	Text string
+	// Err is the cause of the error
+	Err error
+}
+
+// Error will create the message of the error, prefixed by its location
+func (e *ParseError) Error() string {
+	location := []string{}
+	if e.File != "" {
+		location = append(location, e.File)
+	}
+	if e.Line > 0 {
+		location = append(location, strconv.Itoa(e.Line))
+		if e.Column > 0 {
+			location = append(location, strconv.Itoa(e.Column))
+		}
+	}
+	msg := ""
+	if len(location) > 0 {
+		msg = strings.Join(location, ":") + ": "
+	}
+	if e.Key != "" {
+		msg += "parameter " + strconv.Quote(e.Key) + ": "
+	}
+	if e.Text != "" {
+		msg += "value " + strconv.Quote(e.Text) + ": "
+	}
+	if e.Err != nil {
+		msg += e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap will return the cause of the error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ErrNotFound is the error returned by the Get*E functions when the parameter does not exist
+var ErrNotFound = errors.New("The parameter does not exist")
+
+// ErrOverflow is the cause of a ConversionError when the value is out of the range of the expected type
+var ErrOverflow = errors.New("The value is out of range")
+
+// ErrPrecision is the cause of a ConversionError when the value would lose its decimals
+var ErrPrecision = errors.New("The value would lose precision")
+
+// TypeError is the error returned by the Get*E functions when the parameter cannot be converted to the expected type
+type TypeError struct {
+	// Key is the key of the parameter
+	Key string
+	// Expected is the name of the type asked for (int, string, array of int...)
+	Expected string
+	// Actual is the name of the type of the parameter
+	Actual string
+}
+
+// Error will create the message of the error
+func (e *TypeError) Error() string {
+	return "The parameter " + e.Key + " is " + e.Actual + ", expected " + e.Expected
+}
+
+// ConversionError is the error returned by the Get*E functions when the value of the parameter does not fit into the expected type.
+// Err is ErrOverflow or ErrPrecision and can be checked with errors.Is.
+type ConversionError struct {
+	// Key is the key of the parameter
+	Key string
+	// Value is the value of the parameter
+	Value interface{}
+	// Expected is the name of the type asked for
+	Expected string
+	// Err is the cause of the error
+	Err error
+}
+
+// Error will create the message of the error
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("The parameter %s value %v cannot be converted to %s: %v", e.Key, e.Value, e.Expected, e.Err)
+}
+
+// Unwrap will return the cause of the error
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
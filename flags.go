@@ -0,0 +1,155 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// Flags are the command line flags registered for the parameters of a XConfig (see RegisterFlags)
+type Flags struct {
+	config *XConfig
+	set    *flag.FlagSet
+	values map[string]*flagvalue
+}
+
+// flagvalue is the flag.Value of a parameter, it keeps the values given on the command line
+type flagvalue struct {
+	// paramtype is the type of the values, 0 if any type is accepted (empty array)
+	paramtype int
+	array     bool
+	def       string
+	values    []interface{}
+	types     []int
+}
+
+// String will return the default value of the flag
+func (v *flagvalue) String() string {
+	return v.def
+}
+
+// Set will check the type of the value given on the command line and keep it. A repeated flag replaces the value, or adds it for an array
+func (v *flagvalue) Set(s string) error {
+	typeparam, value, err := flagconvert(v.paramtype, s)
+	if err != nil {
+		return err
+	}
+	if !v.array {
+		v.values, v.types = v.values[:0], v.types[:0]
+	}
+	v.values = append(v.values, value)
+	v.types = append(v.types, typeparam)
+	return nil
+}
+
+// IsBoolFlag allows --debug without value for the boolean parameters
+func (v *flagvalue) IsBoolFlag() bool {
+	return v.paramtype == 4 && !v.array
+}
+
+// flagconvert converts the string to the type of the parameter, the integers are accepted for the int64, uint64 and float parameters
+func flagconvert(paramtype int, s string) (int, interface{}, error) {
+	if paramtype == 1 {
+		return 1, s, nil
+	}
+	typeparam, value := infervalue(strings.TrimSpace(s))
+	if paramtype == 0 || typeparam == paramtype {
+		return typeparam, value, nil
+	}
+	if i, ok := value.(int); ok {
+		switch paramtype {
+		case 3:
+			return 3, float64(i), nil
+		case 7:
+			return 7, int64(i), nil
+		case 8:
+			if i >= 0 {
+				return 8, uint64(i), nil
+			}
+		}
+	}
+	return 0, nil, errors.New("The value is not compatible with the type of the parameter")
+}
+
+// RegisterFlags will define a flag on the FlagSet for each value of the XConfig and its sub XConfig, named with its dotted path (see FlatKeys):
+//  --port=8080 --database.host=db.local --hosts=a --hosts=b
+// The type of a flag is the type of the parameter, and its usage is the comment written just before the parameter.
+// The flags already defined on the FlagSet are kept. After the FlagSet is parsed, Apply loads the flags given on the command line into the XConfig:
+//  flags := config.RegisterFlags(flag.CommandLine)
+//  flag.Parse()
+//  err := flags.Apply()
+func (c *XConfig) RegisterFlags(set *flag.FlagSet) *Flags {
+	f := &Flags{config: c, set: set, values: map[string]*flagvalue{}}
+	c.Walk(func(path string, p *Parameter) error {
+		if p.paramtype > 20 || set.Lookup(path) != nil {
+			return nil
+		}
+		v := &flagvalue{paramtype: p.paramtype}
+		defaults := []string{}
+		for _, value := range p.elements() {
+			defaults = append(defaults, fmt.Sprint(value))
+		}
+		if p.paramtype >= 10 && p.paramtype < 20 {
+			v.array = true
+			v.paramtype = p.paramtype - 10
+		}
+		v.def = strings.Join(defaults, ", ")
+		set.Var(v, path, c.usage(path))
+		f.values[path] = v
+		return nil
+	})
+	return f
+}
+
+// usage returns the comment lines written just before the key entry (a dotted path), without the # or ;
+func (c *XConfig) usage(path string) string {
+	config, key, ok := c.locate(path)
+	if !ok {
+		return ""
+	}
+	lines := []string{}
+	for i, k := range config.Order {
+		if k != key {
+			continue
+		}
+		for j := i - 1; j >= 0 && config.Order[j][0] == '#'; j-- {
+			line := strings.TrimSpace(strings.TrimLeft(config.Comments[config.Order[j]], "#;"))
+			if line == "" {
+				break
+			}
+			lines = append([]string{line}, lines...)
+		}
+		break
+	}
+	return strings.Join(lines, " ")
+}
+
+// Apply will load the flags set on the command line into the XConfig, replacing their values as LoadXConfig does.
+// The values are checked by the FlagSet when it is parsed. The flags that are not on the command line do not change the XConfig, and the repeated flags of an array replace all its values.
+// If a flag cannot be loaded, the XConfig is not changed
+func (f *Flags) Apply() error {
+	var err error
+	// the flags are loaded into a copy, so an error does not leave the XConfig half loaded
+	data := f.config.Clone().(*XConfig)
+	f.set.Visit(func(fl *flag.Flag) {
+		v, ok := f.values[fl.Name]
+		if !ok || err != nil {
+			return
+		}
+		meta := []valuemeta{{origin: Origin{File: "--" + fl.Name, Operation: "flag"}}}
+		if err = data.overlay(fl.Name, v.array, v.types, v.values, meta); err != nil {
+			err = &ParseError{File: "--" + fl.Name, Key: fl.Name, Err: err}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	f.config.adopt(data)
+	f.config.Multiple = true
+	return nil
+}
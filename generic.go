@@ -0,0 +1,88 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"fmt"
+	"time"
+)
+
+// Get will return the value of the key entry (a dotted path) converted to the type T, with the same rules as the Get*E functions:
+//  port, err := xconfig.Get[int](config, "server.port")
+// The supported types are string, int, int64, uint64, float64, bool, time.Time, time.Duration, *XConfig and the arrays of them.
+// Any other type T is returned only if the value is exactly of this type.
+func Get[T any](c *XConfig, key string) (T, error) {
+	var zero T
+	var value any
+	var err error
+	switch any(zero).(type) {
+	case string:
+		value, err = c.GetStringE(key)
+	case int:
+		value, err = c.GetIntE(key)
+	case int64:
+		value, err = c.GetInt64E(key)
+	case uint64:
+		value, err = c.GetUint64E(key)
+	case float64:
+		value, err = c.GetFloatE(key)
+	case bool:
+		value, err = c.GetBoolE(key)
+	case time.Time:
+		value, err = c.GetTimeE(key)
+	case time.Duration:
+		value, err = c.GetDurationE(key)
+	case *XConfig:
+		value, err = c.GetConfigE(key)
+	case []string:
+		value, err = c.GetStringCollectionE(key)
+	case []int:
+		value, err = c.GetIntCollectionE(key)
+	case []int64:
+		value, err = c.GetInt64CollectionE(key)
+	case []uint64:
+		value, err = c.GetUint64CollectionE(key)
+	case []float64:
+		value, err = c.GetFloatCollectionE(key)
+	case []bool:
+		value, err = c.GetBoolCollectionE(key)
+	case []time.Time:
+		value, err = c.GetTimeCollectionE(key)
+	case []time.Duration:
+		value, err = c.GetDurationCollectionE(key)
+	default:
+		value, err = c.lookup(key)
+		if err == nil {
+			if _, ok := value.(T); !ok {
+				// the name of T, even if T is an interface
+				err = &TypeError{Key: key, Expected: fmt.Sprintf("%T", &zero)[1:], Actual: typename(value)}
+			}
+		}
+	}
+	if err != nil {
+		return zero, err
+	}
+	return value.(T), nil
+}
+
+// GetOr will return the value of the key entry converted to the type T, or def if the entry does not exist or cannot be converted:
+//  port := xconfig.GetOr(config, "server.port", 80)
+func GetOr[T any](c *XConfig, key string, def T) T {
+	value, err := Get[T](c, key)
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// MustGet will return the value of the key entry converted to the type T, and panics if the entry does not exist or cannot be converted.
+// It is intended for the mandatory parameters read at the start of the program.
+func MustGet[T any](c *XConfig, key string) T {
+	value, err := Get[T](c, key)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
@@ -0,0 +1,515 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"math"
+	"time"
+)
+
+// maxInt and minInt are the limits of the int type of the platform
+const (
+	maxInt = int64(^uint(0) >> 1)
+	minInt = -maxInt - 1
+)
+
+// typename returns the name of the type of a value of the parameters, as used by TypeError
+func typename(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case int:
+		return "int"
+	case int64:
+		return "int64"
+	case uint64:
+		return "uint64"
+	case float64:
+		return "float"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "time"
+	case time.Duration:
+		return "duration"
+	case *XConfig:
+		return "XConfig"
+	case *XConfigCollection:
+		return "collection of XConfig"
+	case []string:
+		return "array of string"
+	case []int:
+		return "array of int"
+	case []int64:
+		return "array of int64"
+	case []uint64:
+		return "array of uint64"
+	case []float64:
+		return "array of float"
+	case []bool:
+		return "array of bool"
+	case []time.Time:
+		return "array of time"
+	case []time.Duration:
+		return "array of duration"
+	case []interface{}:
+		return "empty array"
+	case nil:
+		return "nil"
+	}
+	return "unknown"
+}
+
+// isempty returns true if the value is an explicitly empty array (key=[])
+func isempty(value interface{}) bool {
+	v, ok := value.([]interface{})
+	return ok && len(v) == 0
+}
+
+// floattoint64 converts the float to an int64, with ErrPrecision if it has decimals and ErrOverflow if it does not fit
+func floattoint64(value float64) (int64, error) {
+	if math.IsNaN(value) || value != math.Trunc(value) {
+		return 0, ErrPrecision
+	}
+	// -2^63 is exact as a float, 2^63 is the first float out of range
+	if value < math.MinInt64 || value >= -math.MinInt64 {
+		return 0, ErrOverflow
+	}
+	return int64(value), nil
+}
+
+// GetStringE will return the key entry data as a string
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not a string (arrays and numbers are not formatted as GetString does)
+func (c *XConfig) GetStringE(key string) (string, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return "", err
+	}
+	if v, ok := value.(string); ok {
+		return v, nil
+	}
+	return "", &TypeError{Key: key, Expected: "string", Actual: typename(value)}
+}
+
+// GetIntE will return the key entry data as an int
+// return ErrNotFound if the entry does not exist, a *TypeError if it is not a number or a boolean,
+// or a *ConversionError if the value does not fit into an int or is a float with decimals
+func (c *XConfig) GetIntE(key string) (int, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	v, err := toint64(key, value, "int")
+	if err != nil {
+		return 0, err
+	}
+	if v < minInt || v > maxInt {
+		return 0, &ConversionError{Key: key, Value: value, Expected: "int", Err: ErrOverflow}
+	}
+	return int(v), nil
+}
+
+// GetInt64E will return the key entry data as an int64
+// return ErrNotFound if the entry does not exist, a *TypeError if it is not a number or a boolean,
+// or a *ConversionError if the value does not fit into an int64 or is a float with decimals
+func (c *XConfig) GetInt64E(key string) (int64, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	return toint64(key, value, "int64")
+}
+
+// toint64 converts the value of the key entry to an int64, the errors are reported with the expected type name
+func toint64(key string, value interface{}, expected string) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, &ConversionError{Key: key, Value: value, Expected: expected, Err: ErrOverflow}
+		}
+		return int64(v), nil
+	case float64:
+		i, err := floattoint64(v)
+		if err != nil {
+			return 0, &ConversionError{Key: key, Value: value, Expected: expected, Err: err}
+		}
+		return i, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, &TypeError{Key: key, Expected: expected, Actual: typename(value)}
+}
+
+// GetUint64E will return the key entry data as an uint64
+// return ErrNotFound if the entry does not exist, a *TypeError if it is not a number or a boolean,
+// or a *ConversionError if the value is negative or is a float with decimals
+func (c *XConfig) GetUint64E(key string) (uint64, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	return touint64(key, value, "uint64")
+}
+
+// touint64 converts the value of the key entry to an uint64, the errors are reported with the expected type name
+func touint64(key string, value interface{}, expected string) (uint64, error) {
+	switch v := value.(type) {
+	case uint64:
+		return v, nil
+	case int:
+		if v >= 0 {
+			return uint64(v), nil
+		}
+	case int64:
+		if v >= 0 {
+			return uint64(v), nil
+		}
+	case float64:
+		if math.IsNaN(v) || v != math.Trunc(v) {
+			return 0, &ConversionError{Key: key, Value: value, Expected: expected, Err: ErrPrecision}
+		}
+		// 2^64 is the first float out of range
+		if v >= 0 && v < 1<<64 {
+			return uint64(v), nil
+		}
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, &TypeError{Key: key, Expected: expected, Actual: typename(value)}
+	}
+	return 0, &ConversionError{Key: key, Value: value, Expected: expected, Err: ErrOverflow}
+}
+
+// GetBytesE will return the key entry data as a number of bytes, written as an integer or a size (512MB, 1GiB)
+// return ErrNotFound if the entry does not exist, a *TypeError if it is not an integer or a size,
+// or a *ConversionError if the value is negative
+func (c *XConfig) GetBytesE(key string) (uint64, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	switch v := value.(type) {
+	case uint64:
+		return v, nil
+	case int:
+		if v >= 0 {
+			return uint64(v), nil
+		}
+	case int64:
+		if v >= 0 {
+			return uint64(v), nil
+		}
+	case string:
+		// a size written as a string, for instance with a reference
+		if _, size, ok := parsesize(v); ok {
+			switch s := size.(type) {
+			case int:
+				return uint64(s), nil
+			case int64:
+				return uint64(s), nil
+			case uint64:
+				return s, nil
+			}
+		}
+		return 0, &TypeError{Key: key, Expected: "size", Actual: typename(value)}
+	default:
+		return 0, &TypeError{Key: key, Expected: "size", Actual: typename(value)}
+	}
+	return 0, &ConversionError{Key: key, Value: value, Expected: "size", Err: ErrOverflow}
+}
+
+// GetFloatE will return the key entry data as a float64
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not a number or a boolean
+func (c *XConfig) GetFloatE(key string) (float64, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	return tofloat64(key, value, "float")
+}
+
+// tofloat64 converts the value of the key entry to a float64, the errors are reported with the expected type name
+func tofloat64(key string, value interface{}, expected string) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case bool:
+		if v {
+			return 1.0, nil
+		}
+		return 0.0, nil
+	}
+	return 0, &TypeError{Key: key, Expected: expected, Actual: typename(value)}
+}
+
+// GetBoolE will return the key entry data as a boolean
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not a boolean or a number
+func (c *XConfig) GetBoolE(key string) (bool, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return false, err
+	}
+	return tobool(key, value)
+}
+
+// tobool converts the value of the key entry to a boolean
+func tobool(key string, value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case int:
+		return v != 0, nil
+	case int64:
+		return v != 0, nil
+	case uint64:
+		return v != 0, nil
+	case float64:
+		return v != 0, nil
+	}
+	return false, &TypeError{Key: key, Expected: "bool", Actual: typename(value)}
+}
+
+// GetTimeE will return the key entry data as a time
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not a time
+func (c *XConfig) GetTimeE(key string) (time.Time, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if v, ok := value.(time.Time); ok {
+		return v, nil
+	}
+	return time.Time{}, &TypeError{Key: key, Expected: "time", Actual: typename(value)}
+}
+
+// GetDurationE will return the key entry data as a duration
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not a duration
+func (c *XConfig) GetDurationE(key string) (time.Duration, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return 0, err
+	}
+	if v, ok := value.(time.Duration); ok {
+		return v, nil
+	}
+	return 0, &TypeError{Key: key, Expected: "duration", Actual: typename(value)}
+}
+
+// GetConfigE will return the key entry data as a XConfig
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not a sub XConfig
+func (c *XConfig) GetConfigE(key string) (*XConfig, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := value.(*XConfig); ok {
+		return v, nil
+	}
+	return nil, &TypeError{Key: key, Expected: "XConfig", Actual: typename(value)}
+}
+
+// GetStringCollectionE will return the key entry data as a []string, a single string is returned as an array of 1 string
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not a string or an array of strings
+func (c *XConfig) GetStringCollectionE(key string) ([]string, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case []string:
+		return v, nil
+	case string:
+		return []string{v}, nil
+	}
+	if isempty(value) {
+		return []string{}, nil
+	}
+	return nil, &TypeError{Key: key, Expected: "array of string", Actual: typename(value)}
+}
+
+// GetIntCollectionE will return the key entry data as a []int, a single int is returned as an array of 1 int
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not an int or an array of ints
+func (c *XConfig) GetIntCollectionE(key string) ([]int, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case []int:
+		return v, nil
+	case int:
+		return []int{v}, nil
+	}
+	if isempty(value) {
+		return []int{}, nil
+	}
+	return nil, &TypeError{Key: key, Expected: "array of int", Actual: typename(value)}
+}
+
+// GetInt64CollectionE will return the key entry data as a []int64, a single integer is returned as an array of 1 int64.
+// The arrays of ints are converted, as the arrays of int64 only contain the values out of the int range
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not an integer or an array of integers
+func (c *XConfig) GetInt64CollectionE(key string) ([]int64, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case []int64:
+		return v, nil
+	case int64:
+		return []int64{v}, nil
+	case []int:
+		values := make([]int64, len(v))
+		for i, n := range v {
+			values[i] = int64(n)
+		}
+		return values, nil
+	case int:
+		return []int64{int64(v)}, nil
+	}
+	if isempty(value) {
+		return []int64{}, nil
+	}
+	return nil, &TypeError{Key: key, Expected: "array of int64", Actual: typename(value)}
+}
+
+// GetUint64CollectionE will return the key entry data as a []uint64, a single integer is returned as an array of 1 uint64.
+// The arrays of ints and int64 are converted
+// return ErrNotFound if the entry does not exist, a *TypeError if it is not an integer or an array of integers,
+// or a *ConversionError if a value is negative
+func (c *XConfig) GetUint64CollectionE(key string) ([]uint64, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	var values []uint64
+	switch v := value.(type) {
+	case []uint64:
+		return v, nil
+	case uint64:
+		return []uint64{v}, nil
+	case int, int64:
+		n, err := touint64(key, v, "uint64")
+		if err != nil {
+			return nil, err
+		}
+		return []uint64{n}, nil
+	case []int:
+		for _, i := range v {
+			n, err := touint64(key, i, "uint64")
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, n)
+		}
+		return values, nil
+	case []int64:
+		for _, i := range v {
+			n, err := touint64(key, i, "uint64")
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, n)
+		}
+		return values, nil
+	}
+	if isempty(value) {
+		return []uint64{}, nil
+	}
+	return nil, &TypeError{Key: key, Expected: "array of uint64", Actual: typename(value)}
+}
+
+// GetFloatCollectionE will return the key entry data as a []float64, a single float is returned as an array of 1 float
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not a float or an array of floats
+func (c *XConfig) GetFloatCollectionE(key string) ([]float64, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case []float64:
+		return v, nil
+	case float64:
+		return []float64{v}, nil
+	}
+	if isempty(value) {
+		return []float64{}, nil
+	}
+	return nil, &TypeError{Key: key, Expected: "array of float", Actual: typename(value)}
+}
+
+// GetBoolCollectionE will return the key entry data as a []bool, a single bool is returned as an array of 1 bool
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not a bool or an array of bools
+func (c *XConfig) GetBoolCollectionE(key string) ([]bool, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case []bool:
+		return v, nil
+	case bool:
+		return []bool{v}, nil
+	}
+	if isempty(value) {
+		return []bool{}, nil
+	}
+	return nil, &TypeError{Key: key, Expected: "array of bool", Actual: typename(value)}
+}
+
+// GetTimeCollectionE will return the key entry data as a []time.Time, a single time is returned as an array of 1 time
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not a time or an array of times
+func (c *XConfig) GetTimeCollectionE(key string) ([]time.Time, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case []time.Time:
+		return v, nil
+	case time.Time:
+		return []time.Time{v}, nil
+	}
+	if isempty(value) {
+		return []time.Time{}, nil
+	}
+	return nil, &TypeError{Key: key, Expected: "array of time", Actual: typename(value)}
+}
+
+// GetDurationCollectionE will return the key entry data as a []time.Duration, a single duration is returned as an array of 1 duration
+// return ErrNotFound if the entry does not exist, or a *TypeError if it is not a duration or an array of durations
+func (c *XConfig) GetDurationCollectionE(key string) ([]time.Duration, error) {
+	value, err := c.lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case []time.Duration:
+		return v, nil
+	case time.Duration:
+		return []time.Duration{v}, nil
+	}
+	if isempty(value) {
+		return []time.Duration{}, nil
+	}
+	return nil, &TypeError{Key: key, Expected: "array of duration", Actual: typename(value)}
+}
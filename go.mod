@@ -1,6 +1,6 @@
 module github.com/webability-go/xconfig
 
-go 1.14
+go 1.18
 
 require (
 	github.com/webability-go/xcore/v2 v2.0.8
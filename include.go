@@ -0,0 +1,110 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// includedirective analyzes a @include or @load line.
+// It returns the directive, the path or glob pattern of the files and true if the line is an include directive
+func includedirective(data string) (string, string, bool) {
+	data = strings.TrimSpace(data)
+	for _, directive := range []string{"@include", "@load"} {
+		if strings.HasPrefix(data, directive+" ") || strings.HasPrefix(data, directive+"\t") {
+			pattern := strings.TrimSpace(data[len(directive):])
+			return directive, pattern, pattern != ""
+		}
+	}
+	return "", "", false
+}
+
+// include parses the files of the directive and injects them into the XConfig.
+// @include merges the files into the XConfig, @load loads them with the replacement behaviour.
+// The relative paths are resolved against the directory of the including file.
+// The !key directives of the files are applied on the XConfig before their values, and returned.
+func (c *XConfig) include(line int, data string, directive string, pattern string, source string, stack []string, profile string) ([]*unset, error) {
+	// the directive is kept as a comment so it is written back by Marshal
+	c.addcomment(line, data)
+
+	location := func(err error) ([]*unset, error) {
+		return nil, &ParseError{File: source, Line: line, Column: 1, Err: fmt.Errorf("%s %s: %w", directive, pattern, err)}
+	}
+
+	path := pattern
+	if !filepath.IsAbs(path) && source != "" {
+		path = filepath.Join(filepath.Dir(source), path)
+	}
+	files := []string{path}
+	if strings.ContainsAny(path, "*?[") {
+		var err error
+		files, err = filepath.Glob(path)
+		if err != nil {
+			return location(err)
+		}
+	}
+
+	unsets := []*unset{}
+	for _, file := range files {
+		abspath, err := filepath.Abs(file)
+		if err != nil {
+			return location(err)
+		}
+		for i, included := range stack {
+			if included == abspath {
+				chain := append(append([]string{}, stack[i:]...), abspath)
+				return location(errors.New("include cycle " + strings.Join(chain, " -> ")))
+			}
+		}
+		included := New()
+		err = included.parsefile(file, stack, true, profile)
+		if err != nil {
+			return location(err)
+		}
+		included.markinclude(data, directive)
+		c.addprofile(included.profiles...)
+		for _, u := range included.unsets {
+			c.unset(u.path, u.value, u.hasvalue)
+		}
+		unsets = append(unsets, included.unsets...)
+		err = c.parsemap(included, directive == "@include")
+		if err != nil {
+			return location(err)
+		}
+	}
+	return unsets, nil
+}
+
+// markinclude flags all the values of the XConfig as coming from the include directive (the whole line),
+// operation is the name of the directive set on their origin
+func (c *XConfig) markinclude(directive string, operation string) {
+	for key, p := range c.Parameters {
+		if sub, ok := p.Value.(*XConfig); ok {
+			sub.markinclude(directive, operation)
+			continue
+		}
+		if l, ok := p.Value.(*XConfigCollection); ok {
+			for _, sub := range *l {
+				sub.markinclude(directive, operation)
+			}
+			continue
+		}
+		count := len(p.elements())
+		for len(p.meta) < count {
+			p.meta = append(p.meta, valuemeta{})
+		}
+		for i := range p.meta {
+			p.meta[i].include = directive
+			p.meta[i].origin.Operation = operation
+		}
+		for i := range p.overridden {
+			p.overridden[i].Origin.Operation = operation
+		}
+		c.Parameters[key] = p
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// reference is a parameter being resolved, used to detect the reference cycles
+type reference struct {
+	config *XConfig
+	key    string
+}
+
+// SetInterpolation enables or disables the resolution of the ${...} references into the string values.
+// The interpolation is enabled by default. The flag of the root XConfig applies to all its sub XConfig.
+func (c *XConfig) SetInterpolation(enabled bool) {
+	c.nointerpolation = !enabled
+}
+
+// Interpolate will replace the ${...} references of the string by their values
+func (c *XConfig) Interpolate(data string) (string, error) {
+	value, err := c.interpolate(data, nil, nil)
+	if err != nil {
+		return data, err
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// path returns the dotted path of the sub XConfig from the root XConfig, with a final dot, or "" for the root XConfig
+func (c *XConfig) path() string {
+	if c.parent == nil {
+		return ""
+	}
+	for _, key := range c.parent.Order {
+		switch v := c.parent.Parameters[key].Value.(type) {
+		case *XConfig:
+			if v == c {
+				return c.parent.path() + key + "."
+			}
+		case *XConfigCollection:
+			for i, sub := range *v {
+				if sub == c {
+					return c.parent.path() + key + "[" + strconv.Itoa(i) + "]."
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// root returns the XConfig containing all the sub XConfig
+func (c *XConfig) root() *XConfig {
+	for c.parent != nil {
+		c = c.parent
+	}
+	return c
+}
+
+// value returns the value of the key entry (a dotted path), with the ${...} references of the strings resolved.
+// If a reference cannot be resolved, the value is returned as is.
+func (c *XConfig) value(path string) (interface{}, bool) {
+	if l, index, ok := c.locateelement(path); ok {
+		return (*l)[index], true
+	}
+	config, key, ok := c.locate(path)
+	if !ok {
+		return nil, false
+	}
+	val := config.Parameters[key]
+	value, err := config.resolve(val.Value, []reference{{config, key}}, nil)
+	if err != nil {
+		return val.Value, true
+	}
+	return value, true
+}
+
+// lookup returns the value of the key entry (a dotted path), with the ${...} references of the strings resolved.
+// It returns ErrNotFound if the entry does not exist, or the error of the references that cannot be resolved.
+func (c *XConfig) lookup(path string) (interface{}, error) {
+	if l, index, ok := c.locateelement(path); ok {
+		return (*l)[index], nil
+	}
+	config, key, ok := c.locate(path)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return config.resolve(config.Parameters[key].Value, []reference{{config, key}}, nil)
+}
+
+// resolve returns the value with the ${...} references of the strings resolved.
+// If scope is not nil, the references are searched into the layers of the stack that contains the XConfig
+func (c *XConfig) resolve(value interface{}, visiting []reference, scope *Stack) (interface{}, error) {
+	if c.root().nointerpolation {
+		return value, nil
+	}
+	switch v := value.(type) {
+	case string:
+		return c.interpolate(v, visiting, scope)
+	case []string:
+		resolved := make([]string, 0, len(v))
+		for _, e := range v {
+			r, err := c.interpolate(e, visiting, scope)
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := r.(string); ok {
+				resolved = append(resolved, s)
+			} else {
+				resolved = append(resolved, fmt.Sprint(r))
+			}
+		}
+		return resolved, nil
+	}
+	return value, nil
+}
+
+// interpolate replaces the ${...} references of the string.
+// A string made of only one reference takes the value and type of the referenced parameter.
+func (c *XConfig) interpolate(data string, visiting []reference, scope *Stack) (interface{}, error) {
+	if !strings.Contains(data, "${") {
+		return data, nil
+	}
+	var result strings.Builder
+	for i := 0; i < len(data); {
+		if strings.HasPrefix(data[i:], "$${") {
+			// $${ is an escaped ${
+			result.WriteString("${")
+			i += 3
+			continue
+		}
+		if !strings.HasPrefix(data[i:], "${") {
+			result.WriteByte(data[i])
+			i++
+			continue
+		}
+		end := strings.Index(data[i:], "}")
+		if end < 0 {
+			return nil, errors.New("The reference is not closed into " + data)
+		}
+		value, err := c.reference(data[i+2:i+end], visiting, scope)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && end == len(data)-1 {
+			return value, nil
+		}
+		switch v := value.(type) {
+		case string:
+			result.WriteString(v)
+		case *XConfig:
+			return nil, errors.New("The reference " + data[i:i+end+1] + " is a sub XConfig and cannot be inserted into a string")
+		default:
+			result.WriteString(fmt.Sprint(v))
+		}
+		i += end + 1
+	}
+	return result.String(), nil
+}
+
+// reference resolves the expression of a ${...} reference: a key, env:VARIABLE, with an optional :-default value.
+// The key is searched into the XConfig, then from the root XConfig, into the layers of the scope if it is not nil.
+func (c *XConfig) reference(expr string, visiting []reference, scope *Stack) (interface{}, error) {
+	name, def, hasdef := expr, "", false
+	if pos := strings.Index(expr, ":-"); pos >= 0 {
+		name, def, hasdef = expr[:pos], expr[pos+2:], true
+	}
+	name = strings.TrimSpace(name)
+
+	if strings.HasPrefix(name, "env:") {
+		if value, ok := os.LookupEnv(name[4:]); ok && value != "" {
+			return value, nil
+		}
+		if hasdef {
+			return def, nil
+		}
+		return nil, errors.New("The environment variable " + name[4:] + " is not set")
+	}
+
+	var config *XConfig
+	var key string
+	ok := false
+	if scope != nil {
+		// the layer with the highest precedence that contains the key
+		if config, key, ok = scope.locate(c.path() + name); !ok {
+			config, key, ok = scope.locate(name)
+		}
+	}
+	if !ok {
+		if config, key, ok = c.locate(name); !ok {
+			config, key, ok = c.root().locate(name)
+		}
+	}
+	if ok {
+		chain := []string{}
+		for _, r := range visiting {
+			chain = append(chain, r.key)
+			if r.config == config && r.key == key {
+				return nil, errors.New("The references are cyclic: " + strings.Join(append(chain, key), " -> "))
+			}
+		}
+		value, err := config.resolve(config.Parameters[key].Value, append(visiting[:len(visiting):len(visiting)], reference{config, key}), scope)
+		if err != nil {
+			return nil, err
+		}
+		if s, isstring := value.(string); !hasdef || !isstring || s != "" {
+			return value, nil
+		}
+	}
+	if hasdef {
+		return def, nil
+	}
+	return nil, errors.New("The reference " + name + " is not defined")
+}
@@ -0,0 +1,207 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"strings"
+	"time"
+)
+
+// MergeMode is the strategy used to inject the parameters of a XConfig into another one (see MergeOptions)
+type MergeMode int
+
+const (
+	// DeepReplace replaces the values, the sub XConfig are injected parameter by parameter. This is the behaviour of the Load* functions
+	DeepReplace MergeMode = iota
+	// ShallowReplace replaces the values and the whole sub XConfig
+	ShallowReplace
+	// Append adds the values to the existing ones, the sub XConfig are injected parameter by parameter. This is the behaviour of the Merge* functions
+	Append
+	// AppendUnique adds the values that do not exist yet into the existing ones, the sub XConfig are injected parameter by parameter
+	AppendUnique
+)
+
+// MergeRule is the strategy to use for the parameters whose path matches the pattern (see Find for the syntax of the pattern)
+type MergeRule struct {
+	Pattern string
+	Mode    MergeMode
+}
+
+// MergeOptions are the options of the Merge*With functions
+type MergeOptions struct {
+	// Mode is the strategy used for the parameters without rule
+	Mode MergeMode
+	// Rules are the strategies by path of parameter, the first rule that matches the path is used
+	Rules []MergeRule
+}
+
+// mode returns the strategy for the parameter of the path (as a list of keys)
+func (opts MergeOptions) mode(keys []string) MergeMode {
+	for _, rule := range opts.Rules {
+		if matchkeys(strings.Split(rule.Pattern, "."), keys) {
+			return rule.Mode
+		}
+	}
+	return opts.Mode
+}
+
+// MergeFileWith will parse the file and inject it into the XConfig with the options
+//  config.MergeFileWith("local.conf", xconfig.MergeOptions{
+//    Mode:  xconfig.DeepReplace,
+//    Rules: []xconfig.MergeRule{{Pattern: "hosts", Mode: xconfig.AppendUnique}, {Pattern: "language.*", Mode: xconfig.ShallowReplace}},
+//  })
+func (c *XConfig) MergeFileWith(filename string, opts MergeOptions) error {
+	data := New()
+	if err := data.parsefile(filename, nil, true, ""); err != nil {
+		return err
+	}
+	// the !key directives of the file apply on the XConfig
+	err := c.atomically(func(config *XConfig) error {
+		config.applyunsets(data.unsets)
+		return config.mergemap(data, opts, nil)
+	})
+	if perr, ok := err.(*ParseError); ok && perr.File == "" {
+		perr.File = filename
+	}
+	return err
+}
+
+// MergeStringWith will parse the string and inject it into the XConfig with the options (see MergeFileWith)
+func (c *XConfig) MergeStringWith(data string, opts MergeOptions) error {
+	sdata := New()
+	if err := sdata.parsestring(data, true, ""); err != nil {
+		return err
+	}
+	return c.atomically(func(config *XConfig) error {
+		config.applyunsets(sdata.unsets)
+		return config.mergemap(sdata, opts, nil)
+	})
+}
+
+// MergeXConfigWith will inject the XConfig into the existing one with the options (see MergeFileWith)
+func (c *XConfig) MergeXConfigWith(data *XConfig, opts MergeOptions) error {
+	return c.atomically(func(config *XConfig) error {
+		return config.mergemap(data, opts, nil)
+	})
+}
+
+// atomically runs fn on a clone of the XConfig and adopts the clone if fn succeeds, so an error leaves the XConfig unchanged
+func (c *XConfig) atomically(fn func(config *XConfig) error) error {
+	config := c.Clone().(*XConfig)
+	if err := fn(config); err != nil {
+		return err
+	}
+	c.adopt(config)
+	return nil
+}
+
+// mergemap injects the parameters of data into the XConfig with the options, prefix is the path of the XConfig
+func (c *XConfig) mergemap(data *XConfig, opts MergeOptions, prefix []string) error {
+	if len(c.Parameters) == 0 && len(c.Order) == 0 {
+		c.Parameters = data.Parameters
+		c.Comments = data.Comments
+		c.Order = data.Order
+		for _, v := range c.Parameters {
+			c.attach(v.Value)
+		}
+		return nil
+	}
+	for _, p := range data.Order {
+		if p[0] == '#' {
+			continue
+		}
+		v := data.Parameters[p]
+		keys := append(prefix[:len(prefix):len(prefix)], p)
+		// += always adds and := always replaces, = uses the mode
+		mode := opts.mode(keys)
+		switch {
+		case v.assignment == 2 && mode != AppendUnique:
+			mode = Append
+		case v.assignment == 1 && mode != ShallowReplace:
+			mode = DeepReplace
+		}
+		var err error
+		if newsub, ok := v.Value.(*XConfig); ok && mode != ShallowReplace {
+			if old, ok := c.Parameters[p]; ok {
+				if sub, ok := old.Value.(*XConfig); ok {
+					// the sub XConfig are injected parameter by parameter
+					if err := sub.mergemap(newsub, opts, keys); err != nil {
+						return err
+					}
+					continue
+				}
+			}
+		}
+		// the values already have their line
+		switch mode {
+		case Append:
+			err = c.addparam(0, p, v.paramtype, v.Value, v.assignment, v.meta)
+		case AppendUnique:
+			err = c.addunique(p, v)
+		default:
+			err = c.setparam(0, p, v.paramtype, v.Value, v.assignment, v.meta)
+		}
+		if err != nil {
+			perr := &ParseError{Key: strings.Join(keys, "."), Err: err}
+			if len(v.meta) > 0 && v.meta[0].origin.Line > 0 {
+				// the location of the value into its source
+				perr.File, perr.Line, perr.Column = v.meta[0].origin.File, v.meta[0].origin.Line, 1
+			}
+			return perr
+		}
+		if len(v.overridden) > 0 || v.written != nil {
+			// the values replaced into the data itself are kept too
+			np := c.Parameters[p]
+			np.overridden = append(np.overridden, v.overridden...)
+			if v.written != nil {
+				np.written = v.written
+			}
+			c.Parameters[p] = np
+		}
+	}
+	c.Multiple = true
+	return nil
+}
+
+// addunique adds the values of the parameter that are not already into the key entry
+func (c *XConfig) addunique(key string, v Parameter) error {
+	old, ok := c.Parameters[key]
+	if !ok || v.paramtype > 20 || v.paramtype == 10 {
+		return c.addparam(0, key, v.paramtype, v.Value, v.assignment, v.meta)
+	}
+	existing := old.elements()
+	for i, value := range v.elements() {
+		if contains(existing, value) {
+			continue
+		}
+		var meta []valuemeta
+		if i < len(v.meta) {
+			meta = v.meta[i : i+1]
+		}
+		// the type of a single value of the array
+		err := c.addparam(0, key, v.paramtype%10, value, v.assignment, meta)
+		if err != nil {
+			return err
+		}
+		existing = append(existing, value)
+	}
+	return nil
+}
+
+// contains returns true if the value is into the list of values
+func contains(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if t, ok := v.(time.Time); ok {
+			if u, ok := value.(time.Time); ok && t.Equal(u) {
+				return true
+			}
+			continue
+		}
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
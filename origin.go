@@ -0,0 +1,157 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Origin is the place a value comes from
+type Origin struct {
+	// File is the name of the file, empty if the value comes from a string or a function call
+	File string
+	// Line is the line of the value into the source, starting at 1 (0 if the value comes from a function call)
+	Line int
+	// Operation is the operation that set the value: load, merge, @include, @load, set, add, env, flag or profile followed by its name
+	Operation string
+}
+
+// String will create the description of the origin, as "merge local.conf:3"
+func (o Origin) String() string {
+	location := o.File
+	if o.Line > 0 {
+		if location != "" {
+			location += ":"
+		}
+		location += strconv.Itoa(o.Line)
+	}
+	if location == "" {
+		return o.Operation
+	}
+	return o.Operation + " " + location
+}
+
+// Layer is a value given to a parameter, with its origin (see Explain)
+type Layer struct {
+	Origin Origin
+	Value  interface{}
+	// Overridden is true if the value was replaced by a later operation
+	Overridden bool
+}
+
+// String will create the description of the layer, as "load global.conf:2: 80 (overridden)"
+func (l Layer) String() string {
+	s := l.Origin.String() + ": " + fmt.Sprint(l.Value)
+	if l.Overridden {
+		s += " (overridden)"
+	}
+	return s
+}
+
+// withline returns a copy of the meta with the line set on the origins without line
+func withline(meta []valuemeta, line int) []valuemeta {
+	if line <= 0 || len(meta) == 0 {
+		return meta
+	}
+	meta = append([]valuemeta(nil), meta...)
+	for i := range meta {
+		if meta[i].origin.Line == 0 {
+			meta[i].origin.Line = line
+		}
+	}
+	return meta
+}
+
+// layers returns the values of the parameter with their origin, one layer for each value of an array
+func (p *Parameter) layers(overridden bool) []Layer {
+	layers := []Layer{}
+	for i, value := range p.elements() {
+		layer := Layer{Value: value, Overridden: overridden}
+		if i < len(p.meta) {
+			layer.Origin = p.meta[i].origin
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+// history returns the layers of the values to keep into the history when the parameter is replaced.
+// The values set by the program (Set and Add) are not kept, so the history does not grow with the calls at runtime
+func (p *Parameter) history() []Layer {
+	layers := []Layer{}
+	for _, layer := range p.layers(true) {
+		if layer.Origin.Operation != "set" && layer.Origin.Operation != "add" {
+			layers = append(layers, layer)
+		}
+	}
+	return layers
+}
+
+// setorigin sets the file and the operation on the values that do not have an operation yet, into the XConfig and its sub XConfig
+func (c *XConfig) setorigin(file string, operation string) {
+	set := func(origin *Origin) {
+		if origin.Operation == "" {
+			origin.File = file
+			origin.Operation = operation
+		}
+	}
+	for _, p := range c.Parameters {
+		switch v := p.Value.(type) {
+		case *XConfig:
+			v.setorigin(file, operation)
+		case *XConfigCollection:
+			for _, sub := range *v {
+				sub.setorigin(file, operation)
+			}
+		}
+		// the meta and the layers are shared with the parameter of the map
+		for i := range p.meta {
+			set(&p.meta[i].origin)
+		}
+		for i := range p.overridden {
+			set(&p.overridden[i].Origin)
+		}
+	}
+}
+
+// Origin will return the origin of the value of the key entry (a dotted path), one origin for each value of an array
+// return false as second parameter if the entry does not exist or is a sub XConfig
+func (c *XConfig) Origin(key string) ([]Origin, bool) {
+	config, key, ok := c.locate(key)
+	if !ok {
+		return nil, false
+	}
+	p := config.Parameters[key]
+	if p.paramtype > 20 {
+		return nil, false
+	}
+	origins := []Origin{}
+	for _, layer := range p.layers(false) {
+		origins = append(origins, layer.Origin)
+	}
+	return origins, true
+}
+
+// Explain will return all the values given to the key entry (a dotted path) with their origins, the oldest first:
+// the values replaced by the next loads and sets are flagged as overridden, and the last ones are the current values.
+//  for _, layer := range config.Explain("port") {
+//    fmt.Println(layer)
+//  }
+//  // load global.conf:2: 80 (overridden)
+//  // load local.conf:1: 8080
+// The values given by Set and Add are not kept once they are replaced.
+// Explain returns nil if the entry does not exist or is a sub XConfig.
+func (c *XConfig) Explain(key string) []Layer {
+	config, key, ok := c.locate(key)
+	if !ok {
+		return nil
+	}
+	p := config.Parameters[key]
+	if p.paramtype > 20 {
+		return nil
+	}
+	return append(append([]Layer{}, p.overridden...), p.layers(false)...)
+}
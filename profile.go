@@ -0,0 +1,196 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"strings"
+)
+
+// profileheader analyzes the name of a [profile:name] section.
+// It returns the name of the profile and true if the section is a profile block
+func profileheader(section string) (string, bool) {
+	if !strings.HasPrefix(section, "profile:") {
+		return "", false
+	}
+	name := strings.TrimSpace(section[len("profile:"):])
+	return name, name != ""
+}
+
+// profilekey analyzes a key@profile=value line.
+// It returns the name of the profile, the line without the @profile, and true if the key has a profile
+func profilekey(data string) (string, string, bool) {
+	if !isparamline(data) {
+		return "", data, false
+	}
+	posequal := strings.Index(data, "=")
+	key := data[:posequal]
+	posat := strings.LastIndex(key, "@")
+	if posat <= 0 {
+		return "", data, false
+	}
+	// the := and += operators follow the profile
+	name := strings.TrimSpace(key[posat+1:])
+	operator := ""
+	if n := len(name); n > 0 && (name[n-1] == ':' || name[n-1] == '+') {
+		name, operator = strings.TrimSpace(name[:n-1]), name[n-1:]
+	}
+	if name == "" {
+		return "", data, false
+	}
+	return name, strings.TrimRight(key[:posat], " \t") + operator + data[posequal:], true
+}
+
+// profileelement analyzes a line of a profile whose key is the path of a parameter of an element of a collection (server[0].weight=5).
+// It returns the path of the element, the line relative to the element, and true if the key contains the path of an element
+func profileelement(data string) (string, string, bool) {
+	if !isparamline(data) {
+		return "", data, false
+	}
+	key := data[:strings.Index(data, "=")]
+	pos := strings.LastIndex(key, "].")
+	if pos < 0 {
+		return "", data, false
+	}
+	return strings.TrimSpace(key[:pos+1]), data[pos+2:], true
+}
+
+// addprofile adds the names to the list of the profiles, once
+func (c *XConfig) addprofile(names ...string) {
+	c.profiles = appendunique(c.profiles, names...)
+}
+
+// appendunique adds the names that are not already into the list
+func appendunique(list []string, names ...string) []string {
+	for _, name := range names {
+		found := false
+		for _, v := range list {
+			if v == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, name)
+		}
+	}
+	return list
+}
+
+// allprofiles returns the profiles of the XConfig and its sub XConfig (the included files add their profiles to the XConfig of their section)
+func (c *XConfig) allprofiles() []string {
+	profiles := append([]string(nil), c.profiles...)
+	for _, key := range c.Order {
+		switch v := c.Parameters[key].Value.(type) {
+		case *XConfig:
+			profiles = appendunique(profiles, v.allprofiles()...)
+		case *XConfigCollection:
+			for _, sub := range *v {
+				profiles = appendunique(profiles, sub.allprofiles()...)
+			}
+		}
+	}
+	return profiles
+}
+
+// profileoverrides keeps the values of the selected profile by section while a source is parsed
+type profileoverrides struct {
+	sections []string
+	configs  map[string]*XConfig
+	// targets are the XConfig of the sections, used for the elements of the collections
+	targets map[string]*XConfig
+	// discard receives the values of the other profiles
+	discard *XConfig
+}
+
+// newprofileoverrides creates the overrides of a source
+func newprofileoverrides() *profileoverrides {
+	return &profileoverrides{
+		configs: map[string]*XConfig{},
+		targets: map[string]*XConfig{},
+		discard: New(),
+	}
+}
+
+// get returns the XConfig that receives the values of the section, or the discarded XConfig if selected is false
+func (o *profileoverrides) get(section string, target *XConfig, selected bool) *XConfig {
+	if !selected {
+		return o.discard
+	}
+	if config, ok := o.configs[section]; ok {
+		return config
+	}
+	config := New()
+	o.sections = append(o.sections, section)
+	o.configs[section] = config
+	o.targets[section] = target
+	return config
+}
+
+// setorigin sets the origin of the values of the selected profile.
+// The values are marked as included, so Marshal writes the lines of the profile instead of the values
+func (o *profileoverrides) setorigin(file string, operation string) {
+	for _, config := range o.configs {
+		config.setorigin(file, operation)
+		config.markinclude(operation, operation)
+	}
+}
+
+// apply injects the values of the elements of the collections into their XConfig, and returns the other values from the root,
+// to be injected once the source is loaded
+func (o *profileoverrides) apply() (*XConfig, error) {
+	root := New()
+	opts := MergeOptions{Mode: DeepReplace}
+	for _, section := range o.sections {
+		if strings.Contains(section, "[") {
+			// the XConfig of the collection is injected as a whole with the source
+			if err := o.targets[section].mergemap(o.configs[section], opts, nil); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		dest := root
+		if section != "" {
+			var err error
+			if dest, err = root.subconfigpath(section); err != nil {
+				return nil, err
+			}
+		}
+		if err := dest.mergemap(o.configs[section], opts, nil); err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
+// Profiles will return the names of the profiles found into the loaded files and strings ([profile:name] blocks and key@name keys), in their order
+func (c *XConfig) Profiles() []string {
+	return append([]string{}, c.profiles...)
+}
+
+// LoadFileProfile will load the file as LoadFile, then load the overrides of the profile written into the file:
+//  port=80
+//  port@prod=443
+//
+//  [profile:staging]
+//  database.host=staging.local
+// The values of the other profiles are ignored.
+func (c *XConfig) LoadFileProfile(filename string, profile string) error {
+	return c.loadandparse(filename, false, profile)
+}
+
+// MergeFileProfile will merge the file as MergeFile, then load the overrides of the profile written into the file (see LoadFileProfile)
+func (c *XConfig) MergeFileProfile(filename string, profile string) error {
+	return c.loadandparse(filename, true, profile)
+}
+
+// LoadStringProfile will load the string as LoadString, then load the overrides of the profile (see LoadFileProfile)
+func (c *XConfig) LoadStringProfile(data string, profile string) error {
+	return c.parsestring(data, false, profile)
+}
+
+// MergeStringProfile will merge the string as MergeString, then load the overrides of the profile (see LoadFileProfile)
+func (c *XConfig) MergeStringProfile(data string, profile string) error {
+	return c.parsestring(data, true, profile)
+}
@@ -0,0 +1,110 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Entry is a parameter found by Find or Match, with its dotted path from the XConfig and its value
+type Entry struct {
+	Path  string
+	Value interface{}
+}
+
+// Find will return the parameters whose dotted path matches the pattern, in the order of the XConfig (depth first).
+//
+// Each key of the pattern is a glob (see path.Match), * matches any key of one level and ** matches any number of levels
+// (at least one at the end of the pattern):
+//  config.Find("language.*.welcome")  // language.en.welcome, language.fr.welcome...
+//  config.Find("feature.**")          // all the parameters under feature, at any depth
+//  config.Find("server[*].host")      // the host of all the XConfig of the server collection
+// The sub XConfig and the collections are returned too when they match, and the elements of a collection are the keys server[0], server[1]...
+// The values are returned with their ${...} references resolved, as Get does.
+func (c *XConfig) Find(pattern string) []Entry {
+	patterns := strings.Split(pattern, ".")
+	entries := []Entry{}
+	c.entries(nil, func(keys []string, value interface{}) {
+		if matchkeys(patterns, keys) {
+			entries = append(entries, Entry{Path: strings.Join(keys, "."), Value: value})
+		}
+	})
+	return entries
+}
+
+// Match will return the parameters whose dotted path matches the regular expression, in the same order and form as Find:
+//  config.Match(regexp.MustCompile(`^feature\.`))
+func (c *XConfig) Match(re *regexp.Regexp) []Entry {
+	entries := []Entry{}
+	c.entries(nil, func(keys []string, value interface{}) {
+		if p := strings.Join(keys, "."); re.MatchString(p) {
+			entries = append(entries, Entry{Path: p, Value: value})
+		}
+	})
+	return entries
+}
+
+// entries calls fn for each parameter of the XConfig and its sub XConfig, depth first in the order of the XConfig.
+// keys is the path of the parameter as a list of keys. The elements of a collection follow the collection itself
+func (c *XConfig) entries(prefix []string, fn func(keys []string, value interface{})) {
+	for _, key := range c.Order {
+		if key[0] == '#' {
+			continue
+		}
+		val, ok := c.Parameters[key]
+		if !ok {
+			continue
+		}
+		keys := append(prefix[:len(prefix):len(prefix)], key)
+		value, err := c.resolve(val.Value, []reference{{c, key}}, nil)
+		if err != nil {
+			value = val.Value
+		}
+		fn(keys, value)
+		switch v := val.Value.(type) {
+		case *XConfig:
+			v.entries(keys, fn)
+		case *XConfigCollection:
+			for i, sub := range *v {
+				element := append(prefix[:len(prefix):len(prefix)], key+"["+strconv.Itoa(i)+"]")
+				fn(element, sub)
+				sub.entries(element, fn)
+			}
+		}
+	}
+}
+
+// matchkeys returns true if the keys match the patterns, ** matching any number of keys
+func matchkeys(patterns []string, keys []string) bool {
+	if len(patterns) == 0 {
+		return len(keys) == 0
+	}
+	if patterns[0] == "**" {
+		if len(patterns) == 1 {
+			// a trailing ** matches what is under the previous key, not the key itself
+			return len(keys) > 0
+		}
+		for i := 0; i <= len(keys); i++ {
+			if matchkeys(patterns[1:], keys[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(keys) == 0 {
+		return false
+	}
+	if patterns[0] != keys[0] {
+		// the brackets of the indexes are literal, server[*] matches server[0]
+		pattern := strings.NewReplacer("[", "\\[", "]", "\\]").Replace(patterns[0])
+		if ok, err := path.Match(pattern, keys[0]); err != nil || !ok {
+			return false
+		}
+	}
+	return matchkeys(patterns[1:], keys[1:])
+}
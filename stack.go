@@ -0,0 +1,402 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/webability-go/xcore/v2"
+)
+
+// stacklayer is a named XConfig of a Stack
+type stacklayer struct {
+	name   string
+	config *XConfig
+}
+
+// Stack is a list of named XConfig layers in precedence order, the last layer pushed wins:
+//  stack := xconfig.NewStack()
+//  stack.Push("defaults", defaults)
+//  stack.Push("etc", etcconfig)
+//  stack.Push("local", localconfig)
+//  port, _ := stack.GetInt("port")         // from local if it is set there, then from etc, then from defaults
+//  _, layer, _ := stack.Lookup("port")     // "local"
+// The values are read from the layers themselves, nothing is copied, so a change into a layer is seen immediately by the stack.
+// The ${...} references are resolved into the stack: a value of a layer can refer to a value of another layer,
+// and the reference takes the value of the layer with the highest precedence that contains it.
+// Stack implements xcore.XDatasetDef and can be used into the templates as a XConfig.
+type Stack struct {
+	layers []stacklayer
+	// parent is the stack of the sub stacks, used to resolve the ${...} references from the root XConfig
+	parent *Stack
+	mutex  sync.RWMutex
+}
+
+var _ xcore.XDatasetDef = (*Stack)(nil)
+
+// NewStack is called to create a new Stack with the layers, the first one has the lowest precedence.
+// The layers are named layer0, layer1... (see Push to name them)
+func NewStack(configs ...*XConfig) *Stack {
+	s := &Stack{}
+	for i, c := range configs {
+		s.layers = append(s.layers, stacklayer{name: "layer" + strconv.Itoa(i), config: c})
+	}
+	return s
+}
+
+// Push will add the XConfig as the layer with the highest precedence.
+// If a layer with the same name already exists, it is replaced at its place (see Replace)
+func (s *Stack) Push(name string, c *XConfig) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if i := s.index(name); i >= 0 {
+		s.layers[i].config = c
+		return
+	}
+	s.layers = append(s.layers, stacklayer{name: name, config: c})
+}
+
+// Replace will replace the XConfig of the named layer, keeping its precedence
+// return false if the layer does not exist
+func (s *Stack) Replace(name string, c *XConfig) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	i := s.index(name)
+	if i < 0 {
+		return false
+	}
+	s.layers[i].config = c
+	return true
+}
+
+// Remove will remove the named layer from the stack
+// return false if the layer does not exist
+func (s *Stack) Remove(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	i := s.index(name)
+	if i < 0 {
+		return false
+	}
+	s.layers = append(s.layers[:i:i], s.layers[i+1:]...)
+	return true
+}
+
+// Layer will return the XConfig of the named layer
+// return false as second parameter if the layer does not exist
+func (s *Stack) Layer(name string) (*XConfig, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	i := s.index(name)
+	if i < 0 {
+		return nil, false
+	}
+	return s.layers[i].config, true
+}
+
+// Layers will return the names of the layers, the lowest precedence first
+func (s *Stack) Layers() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	names := []string{}
+	for _, l := range s.layers {
+		names = append(names, l.name)
+	}
+	return names
+}
+
+// index returns the position of the named layer, or -1
+func (s *Stack) index(name string) int {
+	for i, l := range s.layers {
+		if l.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// find returns the layer with the highest precedence that contains the key entry
+func (s *Stack) find(key string) (*stacklayer, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for i := len(s.layers) - 1; i >= 0; i-- {
+		c := s.layers[i].config
+		if c == nil {
+			continue
+		}
+		_, _, element := c.locateelement(key)
+		if _, _, ok := c.locate(key); ok || element {
+			l := s.layers[i]
+			return &l, true
+		}
+	}
+	return nil, false
+}
+
+// locate returns the XConfig and the key of the entry into the layer with the highest precedence that contains it
+func (s *Stack) locate(path string) (*XConfig, string, bool) {
+	l, ok := s.find(path)
+	if !ok {
+		return nil, "", false
+	}
+	return l.config.locate(path)
+}
+
+// root returns the stack containing all the sub stacks
+func (s *Stack) root() *Stack {
+	for s.parent != nil {
+		s = s.parent
+	}
+	return s
+}
+
+// value returns the value of the key entry from the layer with the highest precedence that contains it, and the name of the layer.
+// The ${...} references of the strings are resolved into the stack, if a reference cannot be resolved, the value is returned as is.
+func (s *Stack) value(key string) (interface{}, string, bool) {
+	l, ok := s.find(key)
+	if !ok {
+		return nil, "", false
+	}
+	if list, index, ok := l.config.locateelement(key); ok {
+		return (*list)[index], l.name, true
+	}
+	config, key, _ := l.config.locate(key)
+	val := config.Parameters[key]
+	value, err := config.resolve(val.Value, []reference{{config, key}}, s.root())
+	if err != nil {
+		return val.Value, l.name, true
+	}
+	return value, l.name, true
+}
+
+// single returns a XConfig that contains only the value of the key entry, with its ${...} references resolved into the stack.
+// It is used to convert the value as the Get* functions of the XConfig do
+func (s *Stack) single(key string) (*XConfig, bool) {
+	value, _, ok := s.value(key)
+	if !ok {
+		return nil, false
+	}
+	c := New()
+	c.nointerpolation = true
+	c.Parameters["value"] = Parameter{Value: value}
+	c.Order = []string{"value"}
+	return c, true
+}
+
+// Lookup will return the value of the key entry and the name of the layer it comes from.
+// A sub XConfig is the one of the layer (see GetStack to get the sub XConfig of all the layers)
+// return false as third parameter if no layer contains the entry
+func (s *Stack) Lookup(key string) (interface{}, string, bool) {
+	return s.value(key)
+}
+
+// String will create a string of the layers of the stack, the lowest precedence first
+func (s *Stack) String() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	sdata := []string{}
+	for _, l := range s.layers {
+		if l.config != nil {
+			sdata = append(sdata, l.name+": "+l.config.String())
+		}
+	}
+	return "Stack[\n" + strings.Join(sdata, "") + "]\n"
+}
+
+// GoString will create a string of the layers of the stack (based on String)
+func (s *Stack) GoString() string {
+	return "#" + s.String()
+}
+
+// Set will set the value of the key entry into the layer with the highest precedence, a "set" layer is created if the stack is empty
+func (s *Stack) Set(key string, value interface{}) {
+	s.mutex.Lock()
+	if len(s.layers) == 0 {
+		s.layers = append(s.layers, stacklayer{name: "set", config: New()})
+	}
+	c := s.layers[len(s.layers)-1].config
+	s.mutex.Unlock()
+	c.Set(key, value)
+}
+
+// Get will return the value of the key entry from the layer with the highest precedence that contains it.
+// A sub XConfig is returned as a Stack of the sub XConfig of all the layers, as GetDataset does
+// return false as second parameter if no layer contains the entry
+func (s *Stack) Get(key string) (interface{}, bool) {
+	value, _, ok := s.value(key)
+	if _, isconfig := value.(*XConfig); isconfig {
+		if sub := s.GetStack(key); sub != nil {
+			return sub, true
+		}
+	}
+	return value, ok
+}
+
+// GetDataset will return the key entry as a Stack of the sub XConfig of all the layers that contain it, in the same order.
+// return false as second parameter if the layer with the highest precedence that contains the entry does not contain a sub XConfig
+func (s *Stack) GetDataset(key string) (xcore.XDatasetDef, bool) {
+	if sub := s.GetStack(key); sub != nil {
+		return sub, true
+	}
+	return nil, false
+}
+
+// GetStack will return the key entry as a Stack of the sub XConfig of all the layers that contain it (see GetDataset), or nil
+func (s *Stack) GetStack(key string) *Stack {
+	l, ok := s.find(key)
+	if !ok || l.config.GetConfig(key) == nil {
+		return nil
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	sub := &Stack{parent: s}
+	for _, l := range s.layers {
+		if l.config == nil {
+			continue
+		}
+		if c := l.config.GetConfig(key); c != nil {
+			sub.layers = append(sub.layers, stacklayer{name: l.name, config: c})
+		}
+	}
+	return sub
+}
+
+// GetCollection will return the key entry as a collection from the layer with the highest precedence that contains it
+func (s *Stack) GetCollection(key string) (xcore.XDatasetCollectionDef, bool) {
+	if l, ok := s.find(key); ok {
+		return l.config.GetCollection(key)
+	}
+	return nil, false
+}
+
+// GetString will return the key entry as a string from the layer with the highest precedence that contains it
+func (s *Stack) GetString(key string) (string, bool) {
+	if c, ok := s.single(key); ok {
+		return c.GetString("value")
+	}
+	return "", false
+}
+
+// GetBool will return the key entry as a boolean from the layer with the highest precedence that contains it
+func (s *Stack) GetBool(key string) (bool, bool) {
+	if c, ok := s.single(key); ok {
+		return c.GetBool("value")
+	}
+	return false, false
+}
+
+// GetInt will return the key entry as an int from the layer with the highest precedence that contains it
+func (s *Stack) GetInt(key string) (int, bool) {
+	if c, ok := s.single(key); ok {
+		return c.GetInt("value")
+	}
+	return 0, false
+}
+
+// GetFloat will return the key entry as a float64 from the layer with the highest precedence that contains it
+func (s *Stack) GetFloat(key string) (float64, bool) {
+	if c, ok := s.single(key); ok {
+		return c.GetFloat("value")
+	}
+	return 0, false
+}
+
+// GetTime will return the key entry as a time from the layer with the highest precedence that contains it
+func (s *Stack) GetTime(key string) (time.Time, bool) {
+	if c, ok := s.single(key); ok {
+		return c.GetTime("value")
+	}
+	return time.Time{}, false
+}
+
+// GetDuration will return the key entry as a duration from the layer with the highest precedence that contains it
+func (s *Stack) GetDuration(key string) (time.Duration, bool) {
+	if c, ok := s.single(key); ok {
+		return c.GetDuration("value")
+	}
+	return 0, false
+}
+
+// GetStringCollection will return the key entry as an array of strings from the layer with the highest precedence that contains it
+func (s *Stack) GetStringCollection(key string) ([]string, bool) {
+	if c, ok := s.single(key); ok {
+		return c.GetStringCollection("value")
+	}
+	return nil, false
+}
+
+// GetBoolCollection will return the key entry as an array of booleans from the layer with the highest precedence that contains it
+func (s *Stack) GetBoolCollection(key string) ([]bool, bool) {
+	if c, ok := s.single(key); ok {
+		return c.GetBoolCollection("value")
+	}
+	return nil, false
+}
+
+// GetIntCollection will return the key entry as an array of ints from the layer with the highest precedence that contains it
+func (s *Stack) GetIntCollection(key string) ([]int, bool) {
+	if c, ok := s.single(key); ok {
+		return c.GetIntCollection("value")
+	}
+	return nil, false
+}
+
+// GetFloatCollection will return the key entry as an array of float64 from the layer with the highest precedence that contains it
+func (s *Stack) GetFloatCollection(key string) ([]float64, bool) {
+	if c, ok := s.single(key); ok {
+		return c.GetFloatCollection("value")
+	}
+	return nil, false
+}
+
+// GetTimeCollection will return the key entry as an array of times from the layer with the highest precedence that contains it
+func (s *Stack) GetTimeCollection(key string) ([]time.Time, bool) {
+	if c, ok := s.single(key); ok {
+		return c.GetTimeCollection("value")
+	}
+	return nil, false
+}
+
+// Del will delete the key entry from all the layers
+func (s *Stack) Del(key string) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, l := range s.layers {
+		if l.config != nil {
+			l.config.Del(key)
+		}
+	}
+}
+
+// Clone will perform a full clone of the stack and its layers
+func (s *Stack) Clone() xcore.XDatasetDef {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	cloned := &Stack{}
+	for _, l := range s.layers {
+		var c *XConfig
+		if l.config != nil {
+			c = l.config.Clone().(*XConfig)
+		}
+		cloned.layers = append(cloned.layers, stacklayer{name: l.name, config: c})
+	}
+	return cloned
+}
+
+// Flatten will build a new XConfig with the values of all the layers loaded in precedence order (see LoadXConfig)
+func (s *Stack) Flatten() *XConfig {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	flat := New()
+	for _, l := range s.layers {
+		if l.config != nil {
+			flat.LoadXConfig(l.config.Clone().(*XConfig))
+		}
+	}
+	return flat
+}
@@ -0,0 +1,100 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"errors"
+	"strings"
+)
+
+// unset is a !key or !key=value directive, applied on the XConfig before the values of the source are injected
+type unset struct {
+	path     string
+	value    interface{}
+	hasvalue bool
+}
+
+// unsetdirective analyzes a !key or !key=value line.
+// It returns the key, the value as written, true if there is a value, and true if the line is an unset directive
+func unsetdirective(data string) (string, string, bool, bool) {
+	if len(data) == 0 || data[0] != '!' {
+		return "", "", false, false
+	}
+	data = data[1:]
+	if posequal := strings.Index(data, "="); posequal >= 0 {
+		return strings.TrimSpace(data[:posequal]), strings.TrimSpace(data[posequal+1:]), true, true
+	}
+	return strings.TrimSpace(data), "", false, true
+}
+
+// parseunset reads the unset directive of the line into the section, and applies it on the target XConfig (the values already parsed from the same source)
+func parseunset(target *XConfig, section string, key string, strvalue string, hasvalue bool) (*unset, error) {
+	if key == "" {
+		return nil, errors.New("The unset directive needs a key")
+	}
+	u := &unset{path: key, hasvalue: hasvalue}
+	if section != "" {
+		u.path = section + "." + key
+	}
+	if hasvalue {
+		_, value, _, _, err := parsevalue(strvalue)
+		if err != nil {
+			return nil, err
+		}
+		u.value = value
+	}
+	target.unset(key, u.value, u.hasvalue)
+	return u, nil
+}
+
+// applyunsets applies the directives on the XConfig
+func (c *XConfig) applyunsets(unsets []*unset) {
+	for _, u := range unsets {
+		c.unset(u.path, u.value, u.hasvalue)
+	}
+}
+
+// unset deletes the key entry (a dotted path) with Del, or only the values equal to value if hasvalue is true
+func (c *XConfig) unset(path string, value interface{}, hasvalue bool) {
+	if !hasvalue {
+		c.Del(path)
+		return
+	}
+	config, key, ok := c.locate(path)
+	if !ok {
+		return
+	}
+	p := config.Parameters[key]
+	if p.paramtype > 20 {
+		return
+	}
+	np := newParam()
+	if p.paramtype >= 10 {
+		// an array stays an array, even without values
+		np.add(10, []interface{}{}, p.assignment, nil)
+	}
+	removed := false
+	for i, v := range p.elements() {
+		if contains([]interface{}{v}, value) {
+			removed = true
+			continue
+		}
+		var meta []valuemeta
+		if i < len(p.meta) {
+			meta = p.meta[i : i+1]
+		}
+		np.add(p.paramtype%10, v, p.assignment, meta)
+	}
+	if !removed {
+		return
+	}
+	if np.paramtype == 0 {
+		// the only value of the parameter is removed
+		c.Del(path)
+		return
+	}
+	np.overridden = p.overridden
+	config.Parameters[key] = *np
+}
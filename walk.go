@@ -0,0 +1,103 @@
+// Copyright Philippe Thomassigny 2004-2020.
+// Use of this source code is governed by a MIT licence.
+// license that can be found in the LICENSE file.
+
+package xconfig
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// SkipSubtree can be returned by the function of Walk to skip the parameters of a sub XConfig or collection. It is not returned by Walk
+var SkipSubtree = errors.New("skip this subtree")
+
+// WalkFunc is the function called by Walk for each parameter, with its dotted path from the XConfig.
+// p is a copy of the parameter, the changes on it are not kept into the XConfig
+type WalkFunc func(path string, p *Parameter) error
+
+// Walk will call fn for each parameter of the XConfig and its sub XConfig, depth first in the order of the XConfig (the file order).
+// The parameters of the XConfig of a collection are walked after the collection itself, with the path server[0].host.
+// If fn returns SkipSubtree for a sub XConfig or a collection, its parameters are not walked. Any other error stops the walk and is returned.
+func (c *XConfig) Walk(fn WalkFunc) error {
+	return c.walk("", fn)
+}
+
+// walk calls fn for the parameters of the XConfig, prefix is the path of the XConfig
+func (c *XConfig) walk(prefix string, fn WalkFunc) error {
+	for _, key := range c.Order {
+		if key[0] == '#' {
+			continue
+		}
+		p, ok := c.Parameters[key]
+		if !ok {
+			continue
+		}
+		path := prefix + key
+		err := fn(path, &p)
+		if err == SkipSubtree {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch v := p.Value.(type) {
+		case *XConfig:
+			err = v.walk(path+".", fn)
+		case *XConfigCollection:
+			for i, sub := range *v {
+				if err = sub.walk(path+"["+strconv.Itoa(i)+"].", fn); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Keys will return the keys of the parameters of the XConfig, in their order, without the keys of the sub XConfig
+func (c *XConfig) Keys() []string {
+	keys := []string{}
+	for _, key := range c.Order {
+		if _, ok := c.Parameters[key]; ok && key[0] != '#' {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// FlatKeys will return the dotted paths of all the values of the XConfig and its sub XConfig, in their order (see Walk).
+// The sub XConfig and the collections are not listed, only their values (database.host, server[0].host)
+func (c *XConfig) FlatKeys() []string {
+	keys := []string{}
+	c.entries(nil, func(path []string, value interface{}) {
+		if !issubconfig(value) {
+			keys = append(keys, strings.Join(path, "."))
+		}
+	})
+	return keys
+}
+
+// ToFlatMap will return the values of the XConfig and its sub XConfig by dotted path (see FlatKeys), with the ${...} references resolved
+func (c *XConfig) ToFlatMap() map[string]interface{} {
+	values := map[string]interface{}{}
+	c.entries(nil, func(path []string, value interface{}) {
+		if !issubconfig(value) {
+			values[strings.Join(path, ".")] = value
+		}
+	})
+	return values
+}
+
+// issubconfig returns true if the value is a sub XConfig or a collection of them
+func issubconfig(value interface{}) bool {
+	switch value.(type) {
+	case *XConfig, *XConfigCollection:
+		return true
+	}
+	return false
+}
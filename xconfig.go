@@ -92,6 +92,10 @@
 //  # Unused parameter:
 //  # DOMAIN=mydomain.com
 //
+// A comment can also follow a value, if the # or ; is preceded by a space:
+//
+//  MAINPATH=/home/var  # the main path
+//
 //
 // 2. Parameter keys:
 //
@@ -105,6 +109,38 @@
 //
 // In this case the database entry of the XConfig is again another XConfig with 3 parameters  into it: user, pass and db.
 //
+// The dotted path can also be used with the Get*, Set, Add and Del functions: config.GetString("database.user").
+// Set and Add create the missing sub XConfig.
+//
+// The sub set of parameters can also be written with a [section] header, the following keys are added into the section until the next header.
+// A section can also be a sub set ([database.replica]), and [] comes back to the root level:
+//
+//  [database]
+//  user=username
+//  pass=password
+//  db=dbname
+//
+// Marshal writes the sub sets as dotted keys, and MarshalWith(xconfig.MarshalOptions{Sections: true}) writes them as sections.
+//
+// A list of sub sets is written with repeated [[section]] headers, each one adds a new XConfig to the collection.
+// A [section] header or a dotted key starting with the name of the collection goes into its last XConfig.
+// The elements can also be written with their index, starting at 0:
+//
+//  [[server]]
+//  host=alpha.local
+//  weight=2
+//
+//  [[server]]
+//  host=beta.local
+//
+//  # same as
+//  server[0].host=alpha.local
+//  server[0].weight=2
+//  server[1].host=beta.local
+//
+// The collection is a *XConfigCollection, returned by GetCollection as a xcore.XDatasetCollectionDef so it can be used into the loops of the templates,
+// and its elements can be read with their path: config.GetString("server[1].host").
+//
 //
 // 3. Assignation sign:
 //
@@ -119,7 +155,7 @@
 //
 // 4. Parameter values:
 //
-// There are 4 types of values:
+// There are 6 types of values:
 //
 // - Strings
 //
@@ -129,17 +165,50 @@
 //
 // - Boolean
 //
-// The value has no restrictions except it must enter into the line (no line breaks allowed)
+// - Time
+//
+// - Duration
+//
+// The value has no restrictions except it must enter into the line, unless it is written as a multi-line value (see below).
 // The compiler accepts strings "true", "on", "yes" as a boolean 'true' and "false", "off", "no", "none" as a boolean 'false'.
 // For instance, that means parameter=off is a boolean false, and parameter=yes is a boolean true in the XConfig structure.
 //
 // The compiler also convert all integers to an int parameter in the XConfig structure, and float values as float64 type.
+// The integers can be written in hexadecimal (0x1F), octal (0o755) or binary (0b101), with _ separators (1_000_000),
+// and as a byte size with a SI (kB, MB, GB...) or IEC (KiB, MiB, GiB...) unit: 512MB is the integer 512000000.
+// An integer out of the int range is an int64, or an uint64 if it is out of the int64 range.
+// Marshal keeps the original notation of the numbers.
+// RFC 3339 timestamps (2021-11-16T10:30:00-06:00, with or without zone) and dates (2021-11-16) are converted to a time.Time,
+// and Go durations (30s, 5m, 1h30m) to a time.Duration. Marshal writes them back in their canonical form.
 // If you want a natural integer, float or boolean interpreted as a string, you must start it with a " character:
-// param1="123   will be the string 123 in the XConfig structure
+// param1="123   will be the string 123 in the XConfig structure, the whole rest of the line is the string (no comment)
 //
 // If you want a string starting with a ", you will need to put 2 " at the beginning:
 // param=""abc   will be the string "abc in the XConfig structure
 //
+// A value can also be a quoted string, closed by a " and optionally followed by a comment.
+// The quoted string accepts the escape sequences \n, \t, \", \\ and \uXXXX:
+//
+//  param="  hello \"world\"\n"   # the spaces are kept
+//
+// Marshal quotes and escapes the strings when needed so they are read back as the same value.
+//
+// Multi-line values are always strings. They can be written as a heredoc, closed by a line containing only the tag:
+//
+//  certificate=<<PEM
+//  -----BEGIN CERTIFICATE-----
+//  MIIBszCCAVmgAwIBAgIUQ
+//  -----END CERTIFICATE-----
+//  PEM
+//
+// or by ending each line with a \, the line break is kept into the value:
+//
+//  query=SELECT *\
+//    FROM users\
+//    WHERE id=1
+//
+// Marshal writes the multi-line values back in the same form, and new multi-line values as a heredoc.
+//
 // 3. list of values:
 //
 // You can repeat as many time you need the same parameter name with different values.
@@ -200,6 +269,13 @@
 //
 // Once loaded you will get a []string{“es”, “en”, “fr”, “jp”} assigned to the “languages” parameter.
 //
+// The list of values can also be written as an inline array, with the same type rules. The values can be quoted strings:
+//
+//  languages=[es, en, "fr", jp]
+//  ports=[80, 443]
+//
+// An empty inline array [] creates an empty list, for instance to empty a list in a local config file loaded over the main one.
+//
 //
 // Merging vs Loading
 //
@@ -245,6 +321,189 @@
 //  domain=test.com
 //  title=Welcome
 //
+// The sub XConfig are loaded and merged parameter by parameter: a local file with database.pass=secret replaces the password only,
+// database.user and the other parameters of the main file are kept.
+//
+// The MergeFileWith, MergeStringWith and MergeXConfigWith functions accept a MergeOptions to choose the behaviour,
+// for all the parameters or by path pattern (see Find for the syntax), the first rule that matches the path is used:
+//
+//  config.MergeFileWith("local.conf", xconfig.MergeOptions{
+//    Mode: xconfig.DeepReplace,  // like Load*
+//    Rules: []xconfig.MergeRule{
+//      {Pattern: "hosts", Mode: xconfig.AppendUnique},       // add the hosts not already into the list
+//      {Pattern: "language", Mode: xconfig.ShallowReplace},  // replace the whole sub XConfig
+//    },
+//  })
+//
+// The modes are DeepReplace (the Load* behaviour), ShallowReplace, Append (the Merge* behaviour) and AppendUnique.
+// += always adds the values, and := always replaces them, except with ShallowReplace that also replaces the sub XConfig.
+//
+// A file loaded or merged over the configuration can remove parameters with the !key directive, and !key=value removes only this value of an array.
+// The key can be a sub XConfig (the whole subtree is deleted) or an element of a collection, and is relative to the current [section]:
+//
+//  !hosts=old.example.com
+//  !cache
+//  !server[0]
+//
+//  [database]
+//  !password
+//
+// The directives are applied before the values of the file are injected, so a removed parameter can be written again into the same file.
+// Into an included file, they also apply to the values of the including file written before the include directive, and to the configuration it is loaded over.
+// With MergeFileWith and MergeStringWith, they apply on the configuration before the values are merged.
+//
+// References
+//
+// A string value can contain ${...} references to other parameters or environment variables, resolved when the value is read with Get*.
+// The key is searched into the same sub XConfig first, then from the root XConfig.
+// A default value can be given with :-, used when the reference is not defined or empty, and $${ is a literal ${:
+//
+//  basedir=/var/app
+//  logdir=${basedir}/logs
+//  dsn=${database.user}@${database.host}
+//  home=${env:HOME}
+//  title=${title:-My application}
+//
+// A value made of only one reference takes the type of the referenced parameter.
+// The references are resolved after all the files are loaded, Marshal keeps the templates, and SetInterpolation(false) disables the resolution.
+//
+// Origin of the values
+//
+// Each value keeps the file, line and operation (load, merge, @include, @load, set, add, env, flag or profile) it comes from, returned by Origin.
+// Explain returns all the values given to a parameter, with the ones replaced by the next loads flagged as overridden:
+//
+//  config.LoadFile("global.conf")
+//  config.LoadFile("local.conf")
+//  for _, layer := range config.Explain("port") {
+//    fmt.Println(layer)
+//  }
+//  // load global.conf:2: 80 (overridden)
+//  // load local.conf:1: 8080
+//
+// The values given by Set and Add are not kept once they are replaced, so the history does not grow with the calls at runtime.
+//
+// Profiles
+//
+// A file can contain the values of several profiles (dev, staging, prod...), into [profile:name] blocks or with a key@name key.
+// LoadFileProfile and MergeFileProfile load the file with the overrides of the selected profile, that always replace the values,
+// and the other profiles are ignored, as by LoadFile and MergeFile. Profiles returns the names of the profiles found into the loaded files:
+//
+//  port=80
+//  port@prod=443
+//
+//  [database]
+//  host=localhost
+//  host@staging=staging.local
+//
+//  [profile:prod]
+//  database.host=db.prod
+//
+//  config.LoadFileProfile("app.conf", "prod")  // port=443, database.host=db.prod
+//
+// Marshal writes the values without the overrides of the selected profile, followed by the key@name lines and [profile:name] blocks as they were written,
+// so the profiles are kept when the string is loaded again.
+//
+// Environment variables
+//
+// LoadEnv loads the environment variables with a prefix over the XConfig, with the Load* behaviour.
+// The keys of the sub XConfig are separated by __ and the names are matched without case, the values are typed as into a config file
+// and the value of an array parameter is a list separated by commas:
+//
+//  // APP_PORT=8080 APP_DATABASE__HOST=db.local APP_HOSTS=a,b
+//  config.LoadEnv("APP", xconfig.EnvOptions{})
+//  // with Strict, a variable without a matching parameter is an error
+//  config.LoadEnv("APP", xconfig.EnvOptions{Strict: true})
+//
+// EnvDoc returns the names of all the variables accepted for the parameters of the XConfig (APP_PORT, APP_DATABASE__HOST...).
+//
+// Command line flags
+//
+// RegisterFlags defines a flag for each value of the XConfig on a flag.FlagSet, named with its dotted path and typed as the parameter,
+// with the comment written before the parameter as usage. Once the FlagSet is parsed, Apply loads only the flags given on the command line,
+// and the repeated flags of an array replace all its values:
+//
+//  flags := config.RegisterFlags(flag.CommandLine)
+//  flag.Parse()  // --port=8080 --database.host=db.local --hosts=a --hosts=b
+//  err := flags.Apply()
+//
+// Layers
+//
+// A Stack keeps several XConfig as named layers in precedence order, for instance defaults < /etc file < local file, without copying them.
+// The Get* functions read the value from the last layer that contains the key, Lookup returns the name of that layer too,
+// and a layer can be replaced at any time. A Stack implements xcore.XDatasetDef and can be used into the templates as a XConfig:
+//
+//  stack := xconfig.NewStack()
+//  stack.Push("defaults", defaults)
+//  stack.Push("local", local)
+//  port, _, _ := stack.Lookup("port")  // 8080, "local"
+//  stack.Replace("local", newlocal)
+//
+// The ${...} references are resolved into the stack, so logdir=${basedir}/logs into the local layer uses the basedir of the defaults layer.
+// The sub XConfig are returned by Get and GetDataset as a Stack of the sub XConfig of all the layers.
+//
+// Queries
+//
+// Find returns the parameters whose dotted path matches a pattern, with * for any key of one level and ** for any number of levels,
+// and Match returns the ones whose path matches a regular expression. Both return the path and value of each parameter, in the order of the XConfig:
+//
+//  for _, entry := range config.Find("language.*.welcome") {
+//    fmt.Println(entry.Path, entry.Value)
+//  }
+//  features := config.Match(regexp.MustCompile(`^feature\.`))
+//
+// Walk calls a function for every parameter, depth first in the file order, and the function can return SkipSubtree to skip a sub XConfig.
+// Keys returns the keys of the first level, FlatKeys the dotted paths of all the values and ToFlatMap the values by dotted path:
+//
+//  config.Walk(func(path string, p *xconfig.Parameter) error {
+//    if path == "internal" {
+//      return xconfig.SkipSubtree
+//    }
+//    fmt.Println(path, p.Value)
+//    return nil
+//  })
+//
+// Including files
+//
+// A config file can include other files with the @include and @load directives.
+// @include merges the files as if they were written into the including file, @load loads them with the replacement behaviour (see Merging vs Loading).
+// The path can be a glob pattern, and the relative paths are resolved against the directory of the including file:
+//
+//  # main.conf
+//  @include database.conf
+//  @include i18n/*.conf
+//  # the local values replace the values already set
+//  @load local.conf
+//
+// An include cycle is an error, and the errors of the included files are reported with the chain of the include directives.
+// Marshal and SaveFile keep the directives and do not write the values of the included files.
+//
+// Decoding into a structure
+//
+// Decode fills a structure with the parameters, using the xconfig tags of the fields (the field name is used without tag),
+// and Unmarshal parses the data and decodes it in one step:
+//
+//  type Settings struct {
+//    Host    string            `xconfig:"database.host,required"`
+//    Port    int               `xconfig:"database.port"`
+//    Timeout time.Duration     `xconfig:"timeout"`
+//    Hosts   []string          `xconfig:"hosts"`
+//    Labels  map[string]string `xconfig:"labels"`
+//  }
+//  settings := Settings{Port: 5432}
+//  err := config.Decode(&settings)
+//
+// The errors of all the fields are returned together into a *DecodeError, each one with the name of the field and the key of the parameter.
+//
+// FromStruct does the reverse and builds a XConfig from a structure, with the doc tags of the fields written as comments.
+// The omitempty option skips the zero values, so a template file with the default values can be written with Marshal:
+//
+//  type Settings struct {
+//    Host string `xconfig:"database.host" doc:"The host of the database server"`
+//    Port int    `xconfig:"database.port,omitempty"`
+//  }
+//  config, err := xconfig.FromStruct(Settings{Host: "localhost"})
+//  config.SaveFile("template.conf")
+//
 // Advanced use
 //
 // The XConfig object is easily usable as:
@@ -330,6 +589,40 @@
 // If you add new parameters, they will be added to the end of the file. New lines will be removed into the definition of an array of data.
 //
 //
+// Errors
+//
+// The Load* and Merge* functions return a *ParseError when the configuration cannot be parsed.
+// It contains the file, line and column of the offending value, and the cause of the error:
+//
+//  err := config.LoadFile("path/to/your/file.conf")
+//  var perr *xconfig.ParseError
+//  if errors.As(err, &perr) {
+//    fmt.Println(perr.File, perr.Line, perr.Column, perr.Key, perr.Err)
+//  }
+//
+// When a Load* or Merge* function returns an error, the XConfig is not changed.
+//
+// The Get* functions return false when the parameter does not exist or cannot be converted.
+// The Get*E functions (GetIntE, GetStringE, GetStringCollectionE...) return an error that explains why instead:
+// ErrNotFound, a *TypeError with the expected and actual types, or a *ConversionError caused by ErrOverflow or ErrPrecision
+// (for instance a float with decimals read as an int):
+//
+//  port, err := config.GetIntE("port")
+//  var terr *xconfig.TypeError
+//  switch {
+//  case errors.Is(err, xconfig.ErrNotFound):
+//    port = 80
+//  case errors.As(err, &terr):
+//    fmt.Println(terr.Key, "is", terr.Actual, "and should be", terr.Expected)
+//  }
+//
+// The generic functions Get, GetOr and MustGet apply the same conversions for any supported type, the type of GetOr is the type of the default value:
+//
+//  port, err := xconfig.Get[int](config, "server.port")
+//  timeout := xconfig.GetOr(config, "server.timeout", 30*time.Second)
+//  hosts := xconfig.MustGet[[]string](config, "server.hosts")
+//
+//
 package xconfig
 
 import (
@@ -337,18 +630,27 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"math/bits"
 	"os"
-	"regexp"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/webability-go/xcore/v2"
 )
 
 // VERSION is the used version nombre of the XCore library.
-const VERSION = "0.4.3"
+const VERSION = "0.5.0"
+
+// dateFormat is the format of a date without time
+const dateFormat = "2006-01-02"
+
+// timeFormats are the formats of the time values recognized by the parser, RFC 3339 timestamps (with or without zone) and dates
+var timeFormats = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999", dateFormat}
 
 // Parameter is the basic entry parameter into the configuration object
 // Value is the value of the parameter.
@@ -359,7 +661,13 @@ type Parameter struct {
 	//  2: integer, 12 = array of int
 	//  3: float64, 13 = array of float64
 	//  4: bool, 14 = array of boolean
+	//  5: time.Time, 15 = array of time.Time
+	//  6: time.Duration, 16 = array of time.Duration
+	//  7: int64, 17 = array of int64 (integers out of the int range)
+	//  8: uint64, 18 = array of uint64 (integers out of the int64 range)
+	// 10: empty array, the type is set by the first added value
 	// 21: sub XConfig
+	// 22: collection of sub XConfig (*XConfigCollection)
 	paramtype int
 	// Value of the parameter ()
 	Value interface{}
@@ -368,10 +676,30 @@ type Parameter struct {
 	//  1: forced :=
 	//  2: forced +=
 	assignment int
+	// meta is the information kept for each value of the parameter (one entry for a single value, one per value of an array)
+	meta []valuemeta
+	// overridden are the values replaced by the next loads and sets, the oldest first (see Explain). The values set by the program are not kept
+	overridden []Layer
+	// written is the parameter as written into the source, when its values are replaced by the values of an included file.
+	// Marshal writes it instead of the included values
+	written *Parameter
+}
+
+// valuemeta is the information kept for each value of a parameter
+type valuemeta struct {
+	// notation is the original text of the value when it must be written back in a special form (multi-line or quoted strings).
+	// An empty notation means the value is written in its natural form.
+	notation string
+	// include is the include directive the value comes from, empty if the value comes from the source itself
+	include string
+	// inline is true if the value was written into an inline array [a, b, c]
+	inline bool
+	// origin is the source, line and operation that set the value
+	origin Origin
 }
 
 func newParam() *Parameter {
-	return &Parameter{0, nil, 0}
+	return &Parameter{}
 }
 
 func (p *Parameter) set(paramtype int, value interface{}, assignment int) {
@@ -380,11 +708,38 @@ func (p *Parameter) set(paramtype int, value interface{}, assignment int) {
 	p.assignment = assignment
 }
 
-func (p *Parameter) add(paramtype int, value interface{}, assignment int) error {
+func (p *Parameter) add(paramtype int, value interface{}, assignment int, meta []valuemeta) error {
+	if paramtype == 10 {
+		// an empty array only transforms the parameter into an array
+		switch {
+		case p.paramtype == 0:
+			p.set(10, []interface{}{}, assignment)
+		case p.paramtype < 10:
+			p.toarray()
+		case p.paramtype > 20:
+			return errors.New("The parameter cannot add an empty array to a sub XConfig")
+		}
+		return nil
+	}
+	if p.paramtype == 10 {
+		// the empty array takes the type of the first added value
+		if paramtype > 20 {
+			return errors.New("The parameter cannot add a sub XConfig to an array")
+		}
+		p.paramtype = 0
+		err := p.add(paramtype, value, p.assignment, meta)
+		p.toarray()
+		return err
+	}
+	// the integers of different types are added with the same type
+	paramtype, value = p.widen(paramtype, value)
+	// the meta is aligned with the values already set
+	count := len(p.elements())
 	switch p.paramtype {
 	case 0: // not set yet
 		p.paramtype = paramtype
 		p.Value = value
+		p.assignment = assignment
 	case 1: // string
 		if paramtype == 1 {
 			// transform the parameter into an array and change paramtype
@@ -393,7 +748,7 @@ func (p *Parameter) add(paramtype int, value interface{}, assignment int) error
 			p.paramtype = 11
 		} else if paramtype == 11 {
 			// concatenate array of string
-			p.Value = append(value.([]string), p.Value.(string))
+			p.Value = append([]string{p.Value.(string)}, value.([]string)...)
 		} else {
 			return errors.New("The parameter cannot add an incompatible value to a string")
 		}
@@ -405,7 +760,7 @@ func (p *Parameter) add(paramtype int, value interface{}, assignment int) error
 			p.paramtype = 12
 		} else if paramtype == 12 {
 			// concatenate array of int
-			p.Value = append(value.([]int), p.Value.(int))
+			p.Value = append([]int{p.Value.(int)}, value.([]int)...)
 		} else {
 			return errors.New("The parameter cannot add an incompatible value to an integer")
 		}
@@ -417,7 +772,7 @@ func (p *Parameter) add(paramtype int, value interface{}, assignment int) error
 			p.paramtype = 13
 		} else if paramtype == 13 {
 			// concatenate array of float64
-			p.Value = append(value.([]float64), p.Value.(float64))
+			p.Value = append([]float64{p.Value.(float64)}, value.([]float64)...)
 		} else {
 			return errors.New("The parameter cannot add an incompatible value to a float")
 		}
@@ -429,10 +784,58 @@ func (p *Parameter) add(paramtype int, value interface{}, assignment int) error
 			p.paramtype = 14
 		} else if paramtype == 14 {
 			// concatenate array of bool
-			p.Value = append(value.([]bool), p.Value.(bool))
+			p.Value = append([]bool{p.Value.(bool)}, value.([]bool)...)
 		} else {
 			return errors.New("The parameter cannot add an incompatible value to a boolean")
 		}
+	case 5: // time.Time
+		if paramtype == 5 {
+			// transform the parameter into an array and change paramtype
+			sub := make([]time.Time, 0, 2)
+			p.Value = append(sub, p.Value.(time.Time), value.(time.Time))
+			p.paramtype = 15
+		} else if paramtype == 15 {
+			// concatenate array of time.Time
+			p.Value = append([]time.Time{p.Value.(time.Time)}, value.([]time.Time)...)
+		} else {
+			return errors.New("The parameter cannot add an incompatible value to a time")
+		}
+	case 6: // time.Duration
+		if paramtype == 6 {
+			// transform the parameter into an array and change paramtype
+			sub := make([]time.Duration, 0, 2)
+			p.Value = append(sub, p.Value.(time.Duration), value.(time.Duration))
+			p.paramtype = 16
+		} else if paramtype == 16 {
+			// concatenate array of time.Duration
+			p.Value = append([]time.Duration{p.Value.(time.Duration)}, value.([]time.Duration)...)
+		} else {
+			return errors.New("The parameter cannot add an incompatible value to a duration")
+		}
+	case 7: // int64
+		if paramtype == 7 {
+			// transform the parameter into an array and change paramtype
+			sub := make([]int64, 0, 2)
+			p.Value = append(sub, p.Value.(int64), value.(int64))
+			p.paramtype = 17
+		} else if paramtype == 17 {
+			// concatenate array of int64
+			p.Value = append([]int64{p.Value.(int64)}, value.([]int64)...)
+		} else {
+			return errors.New("The parameter cannot add an incompatible value to an int64")
+		}
+	case 8: // uint64
+		if paramtype == 8 {
+			// transform the parameter into an array and change paramtype
+			sub := make([]uint64, 0, 2)
+			p.Value = append(sub, p.Value.(uint64), value.(uint64))
+			p.paramtype = 18
+		} else if paramtype == 18 {
+			// concatenate array of uint64
+			p.Value = append([]uint64{p.Value.(uint64)}, value.([]uint64)...)
+		} else {
+			return errors.New("The parameter cannot add an incompatible value to an uint64")
+		}
 	case 11: // array of string
 		if paramtype == 1 {
 			p.Value = append(p.Value.([]string), value.(string))
@@ -469,22 +872,261 @@ func (p *Parameter) add(paramtype int, value interface{}, assignment int) error
 		} else {
 			return errors.New("The parameter cannot add an incompatible value to an array of booleans")
 		}
+	case 15: // array of time.Time
+		if paramtype == 5 {
+			p.Value = append(p.Value.([]time.Time), value.(time.Time))
+		} else if paramtype == 15 {
+			// concatenate array of time.Time
+			p.Value = append(p.Value.([]time.Time), value.([]time.Time)...)
+		} else {
+			return errors.New("The parameter cannot add an incompatible value to an array of times")
+		}
+	case 16: // array of time.Duration
+		if paramtype == 6 {
+			p.Value = append(p.Value.([]time.Duration), value.(time.Duration))
+		} else if paramtype == 16 {
+			// concatenate array of time.Duration
+			p.Value = append(p.Value.([]time.Duration), value.([]time.Duration)...)
+		} else {
+			return errors.New("The parameter cannot add an incompatible value to an array of durations")
+		}
+	case 17: // array of int64
+		if paramtype == 7 {
+			p.Value = append(p.Value.([]int64), value.(int64))
+		} else if paramtype == 17 {
+			// concatenate array of int64
+			p.Value = append(p.Value.([]int64), value.([]int64)...)
+		} else {
+			return errors.New("The parameter cannot add an incompatible value to an array of int64")
+		}
+	case 18: // array of uint64
+		if paramtype == 8 {
+			p.Value = append(p.Value.([]uint64), value.(uint64))
+		} else if paramtype == 18 {
+			// concatenate array of uint64
+			p.Value = append(p.Value.([]uint64), value.([]uint64)...)
+		} else {
+			return errors.New("The parameter cannot add an incompatible value to an array of uint64")
+		}
 	case 21: // XConfig
 		// pass the addparam to the subset XConfig
+		return nil
+	case 22: // collection of XConfig
+		// the collections are appended by addparam
+		return errors.New("The parameter cannot add an incompatible value to a collection of XConfig")
 	default:
 		return errors.New("Unknow parameter type")
 	}
+	if len(meta) > 0 {
+		for len(p.meta) < count {
+			p.meta = append(p.meta, valuemeta{})
+		}
+		p.meta = append(p.meta[:count], meta...)
+	}
 	return nil
 }
 
+// isinteger returns true if the type is an integer or an array of integers (int, int64 or uint64)
+func isinteger(paramtype int) bool {
+	return paramtype < 20 && (paramtype%10 == 2 || paramtype%10 == 7 || paramtype%10 == 8)
+}
+
+// widen converts the values of the parameter and the value to add to the same integer type when their integer types differ:
+// uint64 if all the values are positive and one of them is an uint64, int64 otherwise.
+// It returns the type and the value to add. The parameter is not changed if the values do not fit into the same type
+func (p *Parameter) widen(paramtype int, value interface{}) (int, interface{}) {
+	if !isinteger(p.paramtype) || !isinteger(paramtype) || p.paramtype%10 == paramtype%10 {
+		return paramtype, value
+	}
+	n := len(p.elements())
+	values := append(p.elements(), (&Parameter{paramtype: paramtype, Value: value}).elements()...)
+	if p.paramtype%10 == 8 || paramtype%10 == 8 {
+		list := []uint64{}
+		for _, v := range values {
+			if u, err := touint64("", v, "uint64"); err == nil {
+				list = append(list, u)
+			}
+		}
+		if len(list) == len(values) {
+			if p.paramtype > 10 {
+				p.Value, p.paramtype = list[:n:n], 18
+			} else {
+				p.Value, p.paramtype = list[0], 8
+			}
+			if paramtype > 10 {
+				return 18, list[n:]
+			}
+			return 8, list[n]
+		}
+	}
+	list := []int64{}
+	for _, v := range values {
+		i, err := toint64("", v, "int64")
+		if err != nil {
+			return paramtype, value
+		}
+		list = append(list, i)
+	}
+	if p.paramtype > 10 {
+		p.Value, p.paramtype = list[:n:n], 17
+	} else {
+		p.Value, p.paramtype = list[0], 7
+	}
+	if paramtype > 10 {
+		return 17, list[n:]
+	}
+	return 7, list[n]
+}
+
+// toarray transforms a single value into an array of one value, and an unset parameter into an empty array
+func (p *Parameter) toarray() {
+	switch v := p.Value.(type) {
+	case string:
+		p.Value = []string{v}
+	case int:
+		p.Value = []int{v}
+	case float64:
+		p.Value = []float64{v}
+	case bool:
+		p.Value = []bool{v}
+	case time.Time:
+		p.Value = []time.Time{v}
+	case time.Duration:
+		p.Value = []time.Duration{v}
+	case int64:
+		p.Value = []int64{v}
+	case uint64:
+		p.Value = []uint64{v}
+	default:
+		if p.paramtype != 0 {
+			return
+		}
+		p.Value = []interface{}{}
+	}
+	p.paramtype += 10
+}
+
+// elements returns the list of values of the parameter, a single value is a list of one element
+func (p *Parameter) elements() []interface{} {
+	var elements []interface{}
+	switch v := p.Value.(type) {
+	case []string:
+		for _, e := range v {
+			elements = append(elements, e)
+		}
+	case []int:
+		for _, e := range v {
+			elements = append(elements, e)
+		}
+	case []float64:
+		for _, e := range v {
+			elements = append(elements, e)
+		}
+	case []bool:
+		for _, e := range v {
+			elements = append(elements, e)
+		}
+	case []time.Time:
+		for _, e := range v {
+			elements = append(elements, e)
+		}
+	case []time.Duration:
+		for _, e := range v {
+			elements = append(elements, e)
+		}
+	case []int64:
+		for _, e := range v {
+			elements = append(elements, e)
+		}
+	case []uint64:
+		for _, e := range v {
+			elements = append(elements, e)
+		}
+	case []interface{}:
+		elements = append(elements, v...)
+	case *XConfig, *XConfigCollection:
+	default:
+		if p.paramtype != 0 {
+			elements = append(elements, v)
+		}
+	}
+	return elements
+}
+
+// formatelement returns the value of the element as written into an inline array
+func (p *Parameter) formatelement(index int, value interface{}) string {
+	if index < len(p.meta) && p.meta[index].notation != "" {
+		return p.meta[index].notation
+	}
+	if v, ok := value.(string); ok {
+		if v == "" || quote(v) != v || strings.ContainsAny(v, ",[]") {
+			return strconv.Quote(v)
+		}
+	}
+	return p.format(index, value)
+}
+
+// format returns the value of the element as written into a config file
+func (p *Parameter) format(index int, value interface{}) string {
+	if index < len(p.meta) && p.meta[index].notation != "" {
+		return p.meta[index].notation
+	}
+	switch v := value.(type) {
+	case string:
+		if strings.Contains(v, "\n") {
+			return heredoc(v)
+		}
+		return quote(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		// a float must keep its point to be read back as a float
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eIN") {
+			s += ".0"
+		}
+		return s
+	case time.Time:
+		// a date alone is written as a date, any other time in RFC 3339 format
+		if v.Location() == time.UTC && v.Equal(v.Truncate(24*time.Hour)) {
+			return v.Format(dateFormat)
+		}
+		return v.Format(time.RFC3339Nano)
+	case time.Duration:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+// operator returns the assignment sign of the parameter as written into a config file
+func (p Parameter) operator() string {
+	switch p.assignment {
+	case 1:
+		return ":="
+	case 2:
+		return "+="
+	}
+	return "="
+}
+
 // Clone is the parameter method to call to make a full clone of the information
 func (p *Parameter) Clone() *Parameter {
 	cloned := newParam()
 	clonedval := p.Value
-	if cloneable, ok := clonedval.(interface{ Clone() xcore.XDatasetDef }); ok {
+	switch cloneable := clonedval.(type) {
+	case interface{ Clone() xcore.XDatasetDef }:
+		clonedval = cloneable.Clone()
+	case interface{ Clone() xcore.XDatasetCollectionDef }:
 		clonedval = cloneable.Clone()
 	}
 	cloned.set(p.paramtype, clonedval, p.assignment)
+	cloned.meta = append([]valuemeta(nil), p.meta...)
+	cloned.overridden = append([]Layer(nil), p.overridden...)
+	cloned.written = p.written
 	return cloned
 }
 
@@ -501,6 +1143,14 @@ type XConfig struct {
 	Multiple    bool
 	multithread bool
 	mutex       sync.RWMutex
+	// parent is the XConfig containing this one as a sub XConfig, nil for the root XConfig
+	parent *XConfig
+	// nointerpolation disables the resolution of the ${...} references (see SetInterpolation)
+	nointerpolation bool
+	// profiles are the names of the profiles found into the loaded sources (see Profiles)
+	profiles []string
+	// unsets are the !key directives of the last parsed source, applied by the XConfig that includes or merges it
+	unsets []*unset
 }
 
 // New is called to create a new empty XConfig object
@@ -522,195 +1172,497 @@ func (c *XConfig) addcomment(line int, comment string) error {
 	return nil
 }
 
-func (c *XConfig) addparam(line int, key string, typeparam int, value interface{}, assignment int) error {
-	// check if key contains "+" (forced array) and . (subset of config)
-	// and creates a Map[] if the value already exists (or just set it)
-	//  keydata, merge := analyzeKey(key)
-	//  mustmerge := false
-	pospoint := strings.Index(key, ".")
-	if pospoint >= 0 {
-		firstkey := strings.TrimSpace(key[:pospoint])
-		subkey := strings.TrimSpace(key[pospoint+1:])
-
-		if val, ok := c.Parameters[firstkey]; ok {
-			// already exists: add the sub parameters, val is an *XConfig
-			val.Value.(*XConfig).addparam(line, subkey, typeparam, value, assignment)
-		} else {
-			// no existe
-			p := newParam()
-			err := p.add(21, New(), assignment)
-			if err != nil {
-				return err
-			}
-			p.Value.(*XConfig).addparam(line, subkey, typeparam, value, assignment)
-			c.Parameters[firstkey] = *p
-			c.Order = append(c.Order, firstkey)
+// subconfig returns the sub XConfig of the key entry, creating it if it does not exist yet.
+// The key can be an element of a collection (key[N]), and the key of a collection is its last element
+func (c *XConfig) subconfig(key string) (*XConfig, error) {
+	if name, index, ok := splitindex(key); ok {
+		return c.element(name, index, true)
+	}
+	if val, ok := c.Parameters[key]; ok {
+		if sub, ok := val.Value.(*XConfig); ok {
+			return sub, nil
 		}
-	} else {
-		if val, ok := c.Parameters[key]; ok {
-			p := newParam()
-			err := p.add(val.paramtype, val.Value, assignment)
-			if err != nil {
-				return err
-			}
-			err = p.add(typeparam, value, assignment)
-			if err != nil {
-				return err
-			}
-			c.Parameters[key] = *p
-		} else {
-			p := newParam()
-			err := p.add(typeparam, value, assignment)
-			if err != nil {
-				return err
-			}
-			c.Parameters[key] = *p
-			c.Order = append(c.Order, key)
+		if l, ok := val.Value.(*XConfigCollection); ok && len(*l) > 0 {
+			return (*l)[len(*l)-1], nil
 		}
+		return nil, errors.New("The parameter " + key + " already exists and is not a sub XConfig")
 	}
-	return nil
-}
-
-func (c *XConfig) setparam(line int, key string, typeparam int, value interface{}, assignment int) error {
-	// check if key contains "+" (forced array) and . (subset of config)
-	// and creates a Map[] if the value already exists (or just set it)
-	//  keydata, merge := analyzeKey(key)
-	//  mustmerge := false
 	p := newParam()
-	p.add(typeparam, value, assignment)
-	if _, ok := c.Parameters[key]; !ok {
-		c.Order = append(c.Order, key)
-	}
+	p.add(21, New(), 0, nil)
 	c.Parameters[key] = *p
-	return nil
+	c.Order = append(c.Order, key)
+	c.attach(p.Value)
+	return p.Value.(*XConfig), nil
 }
 
-func (c *XConfig) parseline(line int, data string, merge bool) error {
-
-	posequal := strings.Index(data, "=")
-
-	// we ignore empty and comments lines, no key=value lines too
-	if len(data) == 0 || data[0] == '#' || data[0] == ';' || posequal < 0 {
-		return c.addcomment(line, data)
-	}
-
-	// we separate the key. if there is no key, we ignore the data
-	key := strings.TrimSpace(data[:posequal])
-	if len(key) == 0 {
-		return c.addcomment(line, data)
+// subconfigpath returns the sub XConfig of the dotted path, creating the missing ones
+func (c *XConfig) subconfigpath(path string) (*XConfig, error) {
+	config := c
+	for _, key := range strings.Split(path, ".") {
+		var err error
+		config, err = config.subconfig(strings.TrimSpace(key))
+		if err != nil {
+			return nil, err
+		}
 	}
+	return config, nil
+}
 
-	// analyse si := or +=
-	assignment := 0
-
-	// we capture the value if it exists. If not, the key entry is initialized with a nil value
-	var value interface{}
-	var typeparam = 1
-	if len(data) > posequal {
-		strvalue := strings.TrimSpace(data[posequal+1:])
-		value = strvalue
-		if len(strvalue) > 0 && strvalue[0] == '"' {
-			value = strvalue[1:]
-		} else {
-			if strvalue == "yes" || strvalue == "true" || strvalue == "on" {
-				value = true
-				typeparam = 4
-			} else if strvalue == "no" || strvalue == "none" || strvalue == "false" || strvalue == "off" {
-				value = false
-				typeparam = 4
-			} else {
-				if intvalue, err := strconv.Atoi(strvalue); err == nil {
-					value = intvalue
-					typeparam = 2
-				} else {
-					if floatvalue, err := strconv.ParseFloat(strvalue, 64); err == nil {
-						value = floatvalue
-						typeparam = 3
-					}
-				}
+// locate returns the XConfig containing the parameter of the dotted path, and the key of the parameter into it
+// The path can go through the elements of the collections (server[0].host)
+func (c *XConfig) locate(path string) (*XConfig, string, bool) {
+	keys := strings.Split(path, ".")
+	config := c
+	for _, key := range keys[:len(keys)-1] {
+		if name, index, ok := splitindex(key); ok {
+			sub, err := config.element(name, index, false)
+			if err != nil {
+				return nil, "", false
 			}
+			config = sub
+			continue
+		}
+		val, ok := config.Parameters[key]
+		if !ok {
+			return nil, "", false
+		}
+		sub, ok := val.Value.(*XConfig)
+		if !ok {
+			return nil, "", false
 		}
+		config = sub
 	}
-	return c.addparam(line, key, typeparam, value, assignment)
+	key := keys[len(keys)-1]
+	if _, ok := config.Parameters[key]; !ok {
+		return nil, "", false
+	}
+	return config, key, true
 }
 
-func (c *XConfig) parsemap(data *XConfig, merge bool) error {
-	if len(c.Parameters) == 0 {
-		c.Parameters = data.Parameters
-		c.Comments = data.Comments
-		c.Order = data.Order
-	} else {
-		line := len(c.Order)
-		for p, v := range (*data).Parameters {
-			if merge {
-				c.addparam(line, p, v.paramtype, v.Value, v.assignment)
-			} else {
-				c.setparam(line, p, v.paramtype, v.Value, v.assignment)
-			}
+// emptykey returns true if the key, or one of the keys of the dotted path, is empty
+func emptykey(path string) bool {
+	for _, key := range strings.Split(path, ".") {
+		if strings.TrimSpace(key) == "" {
+			return true
 		}
-		c.Multiple = true
 	}
-	return nil
+	return false
 }
 
-func (c *XConfig) loadandparse(filename string, merge bool) error {
-	// No filename: we let the config object as is
-	if len(filename) == 0 {
-		return nil
-	}
-	file, err := os.Open(filename)
-	if err != nil {
-		return err
+// attach links the value to the XConfig if it is a sub XConfig or a collection of them
+func (c *XConfig) attach(value interface{}) {
+	switch v := value.(type) {
+	case *XConfig:
+		v.parent = c
+	case *XConfigCollection:
+		for _, sub := range *v {
+			sub.parent = c
+		}
 	}
-	defer file.Close()
+}
 
-	tempConfig := New()
-	scanner := bufio.NewScanner(file)
-	ln := 1
-	for scanner.Scan() {
-		line := scanner.Text()
-		err := tempConfig.parseline(ln, line, merge)
+func (c *XConfig) addparam(line int, key string, typeparam int, value interface{}, assignment int, meta []valuemeta) error {
+	// check if key contains . (subset of config)
+	// and creates a Map[] if the value already exists (or just set it)
+	if emptykey(key) {
+		return errors.New("The parameter " + key + " has an empty key")
+	}
+	pospoint := strings.Index(key, ".")
+	if pospoint >= 0 {
+		firstkey := strings.TrimSpace(key[:pospoint])
+		subkey := strings.TrimSpace(key[pospoint+1:])
+
+		sub, err := c.subconfig(firstkey)
+		if err != nil {
+			return err
+		}
+		return sub.addparam(line, subkey, typeparam, value, assignment, meta)
+	}
+	meta = withline(meta, line)
+	if val, ok := c.Parameters[key]; ok {
+		if sub, ok := val.Value.(*XConfig); ok {
+			if newsub, ok := value.(*XConfig); ok {
+				// adding a sub XConfig to another one merges their parameters
+				return sub.parsemap(newsub, true)
+			}
+		}
+		if l, ok := val.Value.(*XConfigCollection); ok {
+			if newl, ok := value.(*XConfigCollection); ok {
+				// adding a collection to another one appends its XConfig
+				*l = append(*l, *newl...)
+				c.attach(l)
+				return nil
+			}
+		}
+		p := newParam()
+		err := p.add(val.paramtype, val.Value, val.assignment, val.meta)
+		if err != nil {
+			return err
+		}
+		err = p.add(typeparam, value, assignment, meta)
+		if err != nil {
+			return err
+		}
+		p.overridden = val.overridden
+		p.written = val.written
+		c.Parameters[key] = *p
+	} else {
+		p := newParam()
+		err := p.add(typeparam, value, assignment, meta)
 		if err != nil {
 			return err
 		}
-		ln++
+		c.Parameters[key] = *p
+		c.Order = append(c.Order, key)
+		c.attach(value)
 	}
+	return nil
+}
 
-	if err := scanner.Err(); err != nil {
+func (c *XConfig) setparam(line int, key string, typeparam int, value interface{}, assignment int, meta []valuemeta) error {
+	// check if key contains . (subset of config)
+	// and replaces the value if it already exists (or just set it)
+	if emptykey(key) {
+		return errors.New("The parameter " + key + " has an empty key")
+	}
+	pospoint := strings.Index(key, ".")
+	if pospoint >= 0 {
+		firstkey := strings.TrimSpace(key[:pospoint])
+		subkey := strings.TrimSpace(key[pospoint+1:])
+
+		sub, err := c.subconfig(firstkey)
+		if err != nil {
+			return err
+		}
+		return sub.setparam(line, subkey, typeparam, value, assignment, meta)
+	}
+	p := newParam()
+	err := p.add(typeparam, value, assignment, withline(meta, line))
+	if err != nil {
 		return err
 	}
+	if old, ok := c.Parameters[key]; ok {
+		// the replaced values are kept to explain the value
+		p.overridden = append(old.overridden[:len(old.overridden):len(old.overridden)], old.history()...)
+		if p.included() {
+			// the value written into the source is still written by Marshal
+			if !old.included() {
+				written := old
+				written.overridden = nil
+				p.written = &written
+			} else {
+				p.written = old.written
+			}
+		}
+	} else {
+		c.Order = append(c.Order, key)
+	}
+	c.Parameters[key] = *p
+	c.attach(value)
+	return nil
+}
+
+func (c *XConfig) parseline(line int, data string, merge bool) error {
+
+	posequal := strings.Index(data, "=")
+
+	// we ignore empty and comments lines, no key=value lines too
+	if len(data) == 0 || data[0] == '#' || data[0] == ';' || posequal < 0 {
+		return c.addcomment(line, data)
+	}
+
+	// we separate the key. if there is no key, we ignore the data
+	key := strings.TrimSpace(data[:posequal])
+	if len(key) == 0 {
+		return c.addcomment(line, data)
+	}
+
+	// analyse si := or +=
+	key, assignment := analyzeKey(key)
+	if len(key) == 0 {
+		return c.addcomment(line, data)
+	}
 
-	// We need a temporal xconfig and inject at the end because of the merge flag and the + and * flags (hard to change on the fly based on the existante of the old variable vs new variable)
-	c.parsemap(tempConfig, merge)
+	// we capture the value if it exists. If not, the key entry is initialized with a nil value
+	var value interface{}
+	var typeparam = 1
+	var meta []valuemeta
+	var comment string
+	var err error
+	strvalue := strings.TrimSpace(data[posequal+1:])
+	if strings.Contains(strvalue, "\n") {
+		// multi-line values are always strings, and are written back as they were written
+		value = multiline(strvalue)
+		meta = []valuemeta{{notation: strvalue}}
+	} else if arraytype, arrayvalue, arraymeta, arraycomment, ok, arrayerr := parsearray(strvalue); ok {
+		typeparam, value, meta, comment, err = arraytype, arrayvalue, arraymeta, arraycomment, arrayerr
+	} else {
+		var n string
+		typeparam, value, n, comment, err = parsevalue(strvalue)
+		// the meta of the value keeps its origin
+		meta = []valuemeta{{notation: n}}
+	}
+	if err == nil {
+		if assignment == 1 {
+			// := replaces anything already set in the same source
+			err = c.setparam(line, key, typeparam, value, assignment, meta)
+		} else {
+			err = c.addparam(line, key, typeparam, value, assignment, meta)
+		}
+	}
+	if err != nil {
+		// the column points to the value, just after the = sign and the spaces
+		column := posequal + 1 + len(data[posequal+1:]) - len(strings.TrimLeft(data[posequal+1:], " \t"))
+		return &ParseError{
+			Line:   line,
+			Column: utf8.RuneCountInString(data[:column]) + 1,
+			Key:    key,
+			Text:   strvalue,
+			Err:    err,
+		}
+	}
+	if comment != "" {
+		c.addinlinecomment(key, comment)
+	}
 	return nil
 }
 
-func (c *XConfig) parsestring(data string, merge bool) error {
-	// No filename: we let the config object as is
-	if len(data) == 0 {
-		return nil
+// addinlinecomment keeps the comment written after the value of the key, only the first one is kept
+func (c *XConfig) addinlinecomment(key string, comment string) {
+	pospoint := strings.Index(key, ".")
+	if pospoint >= 0 {
+		if sub := c.GetConfig(strings.TrimSpace(key[:pospoint])); sub != nil {
+			sub.addinlinecomment(strings.TrimSpace(key[pospoint+1:]), comment)
+		}
+		return
+	}
+	if _, ok := c.Comments[key]; !ok {
+		c.Comments[key] = comment
+	}
+}
+
+// parsemap injects the parameters of data into the XConfig, replacing them (deep) or adding them if merge is true
+func (c *XConfig) parsemap(data *XConfig, merge bool) error {
+	opts := MergeOptions{Mode: DeepReplace}
+	if merge {
+		opts.Mode = Append
 	}
+	return c.mergemap(data, opts, nil)
+}
 
+// parse reads the source line by line into a temporal XConfig, then injects it into the XConfig.
+// source is the name of the file used into the errors, or empty if the source is a string
+// stack is the list of the absolute paths of the files being parsed, to detect include cycles
+// profile is the selected profile, its overrides are applied after the other values (see LoadFileProfile)
+func (c *XConfig) parse(scanner *bufio.Scanner, source string, stack []string, merge bool, profile string) error {
 	tempConfig := New()
-	scanner := bufio.NewScanner(strings.NewReader(data))
-	line := 0
+	// target is the XConfig of the current [section], the parameters are added into it
+	target := tempConfig
+	section := ""
+	// block is the profile of the current [profile:name] block
+	block := ""
+	overrides := newprofileoverrides()
+	// unsets are the !key directives to apply on the XConfig before the values are injected
+	unsets := []*unset{}
+	line := 1
 	for scanner.Scan() {
 		data := scanner.Text()
-		err := tempConfig.parseline(line, data, merge)
+		start := line
+		if name, ok := sectionheader(data); ok {
+			target = tempConfig
+			section = name
+			block = ""
+			if p, ok := profileheader(name); ok {
+				// the [profile:name] block contains keys of the root level
+				block = p
+				section = ""
+				tempConfig.addprofile(p)
+				// the block is kept as written so it is written back by Marshal
+				tempConfig.addcomment(start, data)
+			} else if repeated, ok := sectionheader(name); ok && repeated != "" {
+				// [[name]] adds a new XConfig to the collection
+				var index int
+				var err error
+				target, index, err = tempConfig.appendelement(repeated)
+				if err != nil {
+					return &ParseError{File: source, Line: start, Column: 1, Key: repeated, Err: err}
+				}
+				section = repeated + "[" + strconv.Itoa(index) + "]"
+			} else if name != "" {
+				var err error
+				target, err = tempConfig.subconfigpath(name)
+				if err != nil {
+					return &ParseError{File: source, Line: start, Column: 1, Key: name, Err: err}
+				}
+			}
+			line++
+			continue
+		}
+		if key, strvalue, hasvalue, ok := unsetdirective(data); ok {
+			if block == "" || block == profile {
+				u, err := parseunset(target, section, key, strvalue, hasvalue)
+				if err != nil {
+					return &ParseError{File: source, Line: start, Column: 1, Key: key, Text: strvalue, Err: err}
+				}
+				// the elements of a collection are injected as a whole, the directive only applies on the values of the source
+				if !strings.Contains(section, "[") {
+					unsets = append(unsets, u)
+				}
+				// the directive is kept as a comment so it is written back by Marshal
+				target.addcomment(start, data)
+			} else {
+				tempConfig.addcomment(start, data)
+			}
+			line++
+			continue
+		}
+		if directive, pattern, ok := includedirective(data); ok {
+			included, err := target.include(start, data, directive, pattern, source, stack, profile)
+			if err != nil {
+				return err
+			}
+			// the directives of the included files apply on the XConfig too, relative to the section
+			if !strings.Contains(section, "[") {
+				for _, u := range included {
+					if section != "" {
+						u.path = section + "." + u.path
+					}
+					unsets = append(unsets, u)
+				}
+			}
+			line++
+			continue
+		}
+		// a multi-line value is passed as a whole to the parser, with its line breaks
+		if tag := heredocTag(data); tag != "" {
+			closed := false
+			for scanner.Scan() {
+				line++
+				data += "\n" + scanner.Text()
+				if strings.TrimSpace(scanner.Text()) == tag {
+					closed = true
+					break
+				}
+			}
+			if !closed {
+				return &ParseError{File: source, Line: start, Text: "<<" + tag, Err: errors.New("The heredoc is not closed with " + tag)}
+			}
+		} else {
+			for continues(data) && scanner.Scan() {
+				line++
+				data += "\n" + scanner.Text()
+			}
+		}
+		lineprofile := block
+		linesection, linetarget := section, target
+		if block != "" {
+			// the lines of the block are kept as written so they are written back by Marshal
+			tempConfig.addcomment(start, data)
+			if !isparamline(data) {
+				line++
+				continue
+			}
+		}
+		if p, rewritten, ok := profilekey(data); ok {
+			lineprofile = p
+			if block == "" {
+				target.addcomment(start, data)
+			}
+			data = rewritten
+			tempConfig.addprofile(p)
+		}
+		if path, relative, ok := profileelement(data); ok && lineprofile != "" && lineprofile == profile {
+			// the value of an element of a collection written with its path (server[0].weight@prod=5) goes into the element
+			if section != "" {
+				path = section + "." + path
+			}
+			element, err := tempConfig.subconfigpath(path)
+			if err != nil {
+				return &ParseError{File: source, Line: start, Column: 1, Key: path, Err: err}
+			}
+			linesection, linetarget, data = path, element, relative
+		}
+		var err error
+		if lineprofile == "" {
+			err = target.parseline(start, data, merge)
+		} else {
+			// the values of the other profiles are parsed to report their errors, but not kept
+			err = overrides.get(linesection, linetarget, lineprofile == profile).parseline(start, data, merge)
+		}
 		if err != nil {
+			if perr, ok := err.(*ParseError); ok {
+				perr.File = source
+				if linesection != "" && perr.Key != "" {
+					perr.Key = linesection + "." + perr.Key
+				}
+			}
 			return err
 		}
 		line++
 	}
 
 	if err := scanner.Err(); err != nil {
+		return &ParseError{File: source, Line: line, Err: err}
+	}
+
+	operation := "load"
+	if merge {
+		operation = "merge"
+	}
+	overrides.setorigin(source, "profile "+profile)
+	tempConfig.setorigin(source, operation)
+	root, err := overrides.apply()
+	if err == nil {
+		// the values are injected into a copy, so an error leaves the XConfig unchanged
+		err = c.atomically(func(config *XConfig) error {
+			config.applyunsets(unsets)
+			// We need a temporal xconfig and inject at the end because of the merge flag and the + and : flags (hard to change on the fly based on the existante of the old variable vs new variable)
+			if err := config.parsemap(tempConfig, merge); err != nil {
+				return err
+			}
+			// the overrides of the profile always replace the values
+			return config.mergemap(root, MergeOptions{Mode: DeepReplace}, nil)
+		})
+	}
+	if err == nil {
+		c.unsets = unsets
+	}
+	c.addprofile(tempConfig.allprofiles()...)
+	if perr, ok := err.(*ParseError); ok && perr.File == "" {
+		perr.File = source
+	}
+	return err
+}
+
+func (c *XConfig) loadandparse(filename string, merge bool, profile string) error {
+	// No filename: we let the config object as is
+	if len(filename) == 0 {
+		return nil
+	}
+	return c.parsefile(filename, nil, merge, profile)
+}
+
+func (c *XConfig) parsefile(filename string, stack []string, merge bool, profile string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	abspath, err := filepath.Abs(filename)
+	if err != nil {
 		return err
 	}
+	return c.parse(bufio.NewScanner(file), filename, append(stack, abspath), merge, profile)
+}
 
-	//  fmt.Println(tempConfig)
+func (c *XConfig) parsestring(data string, merge bool, profile string) error {
+	// No data: we let the config object as is
+	if len(data) == 0 {
+		return nil
+	}
 
-	c.parsemap(tempConfig, merge)
-	return nil
+	return c.parse(bufio.NewScanner(strings.NewReader(data)), "", nil, merge, profile)
 }
 
 // String will create a string of the ordered content of the XConfig
@@ -732,8 +1684,9 @@ func (c *XConfig) GoString() string {
 }
 
 // Set will replace or create the value of the key entry
+// The key can be a dotted path to a parameter of a sub XConfig, the missing sub XConfig are created. A key with an empty part (a. or .a) is ignored
 func (c *XConfig) Set(key string, value interface{}) {
-	// check if key contains "+" (forced array) and . (subset of config)
+	// the . (subset of config) are resolved by setparam
 	// and just replace the value
 	var valuetype int
 	switch value.(type) {
@@ -745,13 +1698,22 @@ func (c *XConfig) Set(key string, value interface{}) {
 		valuetype = 3
 	case bool:
 		valuetype = 4
+	case time.Time:
+		valuetype = 5
+	case time.Duration:
+		valuetype = 6
+	case int64:
+		valuetype = 7
+	case uint64:
+		valuetype = 8
 	}
-	c.setparam(0, key, valuetype, value, 1)
+	c.setparam(0, key, valuetype, value, 0, []valuemeta{{origin: Origin{Operation: "set"}}})
 }
 
 // Add will adds a value to the structure. If the key entry already exists, then try to build a collection of it
+// The key can be a dotted path to a parameter of a sub XConfig, the missing sub XConfig are created
 func (c *XConfig) Add(key string, value interface{}) error {
-	// check if key contains "+" (forced array) and . (subset of config)
+	// the . (subset of config) are resolved by addparam
 	// and creates a Map[] if the value already exists (or just set it)
 	var valuetype int
 	switch value.(type) {
@@ -763,30 +1725,34 @@ func (c *XConfig) Add(key string, value interface{}) error {
 		valuetype = 3
 	case bool:
 		valuetype = 4
+	case time.Time:
+		valuetype = 5
+	case time.Duration:
+		valuetype = 6
+	case int64:
+		valuetype = 7
+	case uint64:
+		valuetype = 8
 	default:
-		return errors.New("The XConfig.Add function only accept string, integer, float64 and boolean values")
+		return errors.New("The XConfig.Add function only accept string, integer, int64, uint64, float64, boolean, time and duration values")
 	}
-	return c.addparam(0, key, valuetype, value, 0)
+	return c.addparam(0, key, valuetype, value, 0, []valuemeta{{origin: Origin{Operation: "add"}}})
 }
 
 // Get will return the value of the key entry
+// The key can be a dotted path to a parameter of a sub XConfig (language.en.welcome), as for all the Get* functions
 // return false as second parameter if the entry does not exists (remember a value can be NIL and exists)
 func (c *XConfig) Get(key string) (interface{}, bool) {
-	// check if key contains "." (subset of config)
-	if val, ok := c.Parameters[key]; ok {
-		return val.Value, true
-	}
-	return nil, false
+	return c.value(key)
 }
 
 // GetDataset will return the key entry data as an XDataset if it exists and is a XDatasetDef
 // return false as second parameter if the entry does not exists (remember a value can be NIL and exists)
 func (c *XConfig) GetDataset(key string) (xcore.XDatasetDef, bool) {
-	// check if key contains "." (subset of config)
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
 		case *XConfig:
-			return val.Value.(*XConfig), true
+			return value.(*XConfig), true
 		}
 	}
 	return nil, false
@@ -795,10 +1761,10 @@ func (c *XConfig) GetDataset(key string) (xcore.XDatasetDef, bool) {
 // GetCollection will return the key entry data as an XDatasetCollectionDef if it exists and is a XDatasetCollectionDef
 // return false as second parameter if the entry does not exists (remember a value can be NIL and exists)
 func (c *XConfig) GetCollection(key string) (xcore.XDatasetCollectionDef, bool) {
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
 		case xcore.XDatasetCollectionDef:
-			return val.Value.(xcore.XDatasetCollectionDef), true
+			return value.(xcore.XDatasetCollectionDef), true
 		}
 	}
 	return nil, false
@@ -807,30 +1773,61 @@ func (c *XConfig) GetCollection(key string) (xcore.XDatasetCollectionDef, bool)
 // GetString will return the key entry data as a string, or ""
 // return false as second parameter if the entry does not exists (remember a value can be "" and exists)
 func (c *XConfig) GetString(key string) (string, bool) {
-	// check if key contains "." (subset of config)
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
 		case string:
-			return val.Value.(string), true
+			return value.(string), true
 		default:
-			return fmt.Sprint(val.Value), true
+			return fmt.Sprint(value), true
 		}
 	}
 	return "", false
 }
 
 // GetInt will return the key entry data as an int, or 0
-// return false as second parameter if the entry does not exists (remember a value can be 0 and exists)
+// return false as second parameter if the entry does not exists or does not fit into an int (remember a value can be 0 and exists)
 func (c *XConfig) GetInt(key string) (int, bool) {
-	// check if key contains "." (subset of config)
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
+		case int:
+			return value.(int), true
+		case int64:
+			if value.(int64) >= minInt && value.(int64) <= maxInt {
+				return int(value.(int64)), true
+			}
+		case uint64:
+			if value.(uint64) <= uint64(maxInt) {
+				return int(value.(uint64)), true
+			}
+		case float64:
+			return int(value.(float64)), true
+		case bool:
+			if value.(bool) {
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+// GetInt64 will return the key entry data as an int64, or 0
+// return false as second parameter if the entry does not exists (remember a value can be 0 and exists)
+func (c *XConfig) GetInt64(key string) (int64, bool) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
+		case int64:
+			return value.(int64), true
 		case int:
-			return val.Value.(int), true
+			return int64(value.(int)), true
+		case uint64:
+			if value.(uint64) <= math.MaxInt64 {
+				return int64(value.(uint64)), true
+			}
 		case float64:
-			return int(val.Value.(float64)), true
+			return int64(value.(float64)), true
 		case bool:
-			if val.Value.(bool) {
+			if value.(bool) {
 				return 1, true
 			}
 			return 0, true
@@ -839,18 +1836,82 @@ func (c *XConfig) GetInt(key string) (int, bool) {
 	return 0, false
 }
 
+// GetUint64 will return the key entry data as an uint64, or 0
+// return false as second parameter if the entry does not exists or is negative (remember a value can be 0 and exists)
+func (c *XConfig) GetUint64(key string) (uint64, bool) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
+		case uint64:
+			return value.(uint64), true
+		case int:
+			if value.(int) >= 0 {
+				return uint64(value.(int)), true
+			}
+		case int64:
+			if value.(int64) >= 0 {
+				return uint64(value.(int64)), true
+			}
+		case float64:
+			if value.(float64) >= 0 {
+				return uint64(value.(float64)), true
+			}
+		case bool:
+			if value.(bool) {
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+// GetBytes will return the key entry data as a number of bytes, written as an integer or a size (512MB, 1GiB), or 0
+// return false as second parameter if the entry does not exists or is not a positive integer (remember a value can be 0 and exists)
+func (c *XConfig) GetBytes(key string) (uint64, bool) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
+		case uint64:
+			return value.(uint64), true
+		case int:
+			if value.(int) >= 0 {
+				return uint64(value.(int)), true
+			}
+		case int64:
+			if value.(int64) >= 0 {
+				return uint64(value.(int64)), true
+			}
+		case string:
+			// a size written as a string, for instance with a reference
+			if _, size, ok := parsesize(value.(string)); ok {
+				switch size.(type) {
+				case int:
+					return uint64(size.(int)), true
+				case int64:
+					return uint64(size.(int64)), true
+				case uint64:
+					return size.(uint64), true
+				}
+			}
+		}
+	}
+	return 0, false
+}
+
 // GetFloat will return the key entry data as a float64, or 0
 // return false as second parameter if the entry does not exists (remember a value can be 0 and exists)
 func (c *XConfig) GetFloat(key string) (float64, bool) {
-	// check if key contains "." (subset of config)
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
 		case float64:
-			return val.Value.(float64), true
+			return value.(float64), true
 		case int:
-			return float64(val.Value.(int)), true
+			return float64(value.(int)), true
+		case int64:
+			return float64(value.(int64)), true
+		case uint64:
+			return float64(value.(uint64)), true
 		case bool:
-			if val.Value.(bool) {
+			if value.(bool) {
 				return 1.0, true
 			}
 			return 0.0, true
@@ -862,28 +1923,42 @@ func (c *XConfig) GetFloat(key string) (float64, bool) {
 // GetTime will return the key entry data as a time, or 0
 // return false as second parameter if the entry does not exists (remember a value can be 0 and exists)
 func (c *XConfig) GetTime(key string) (time.Time, bool) {
-	// check if key contains "." (subset of config)
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
 		case time.Time:
-			return val.Value.(time.Time), true
+			return value.(time.Time), true
 		}
 	}
 	return time.Time{}, false
 }
 
+// GetDuration will return the key entry data as a duration, or 0
+// return false as second parameter if the entry does not exists (remember a value can be 0 and exists)
+func (c *XConfig) GetDuration(key string) (time.Duration, bool) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
+		case time.Duration:
+			return value.(time.Duration), true
+		}
+	}
+	return 0, false
+}
+
 // GetBool will return the key entry data as a boolean, or false
 // return false as second parameter if the entry does not exists (remember a value can be false and exists)
 func (c *XConfig) GetBool(key string) (bool, bool) {
-	// check if key contains "." (subset of config)
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
 		case bool:
-			return val.Value.(bool), true
+			return value.(bool), true
 		case int:
-			return val.Value.(int) != 0, true
+			return value.(int) != 0, true
+		case int64:
+			return value.(int64) != 0, true
+		case uint64:
+			return value.(uint64) != 0, true
 		case float64:
-			return val.Value.(float64) != 0, true
+			return value.(float64) != 0, true
 		}
 	}
 	return false, false
@@ -892,12 +1967,17 @@ func (c *XConfig) GetBool(key string) (bool, bool) {
 // GetStringCollection will return the key entry data as a []string, or nil
 // return false as second parameter if the entry does not exists (remember a value can be nil and exists)
 func (c *XConfig) GetStringCollection(key string) ([]string, bool) {
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
 		case []string:
-			return val.Value.([]string), true
+			return value.([]string), true
+		case []interface{}:
+			// explicitly empty array
+			if len(value.([]interface{})) == 0 {
+				return []string{}, true
+			}
 		case string:
-			return []string{val.Value.(string)}, true
+			return []string{value.(string)}, true
 		}
 	}
 	return nil, false
@@ -906,12 +1986,17 @@ func (c *XConfig) GetStringCollection(key string) ([]string, bool) {
 // GetBoolCollection will return the key entry data as a []bool, or nil
 // return false as second parameter if the entry does not exists (remember a value can be nil and exists)
 func (c *XConfig) GetBoolCollection(key string) ([]bool, bool) {
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
 		case []bool:
-			return val.Value.([]bool), true
+			return value.([]bool), true
+		case []interface{}:
+			// explicitly empty array
+			if len(value.([]interface{})) == 0 {
+				return []bool{}, true
+			}
 		case bool:
-			return []bool{val.Value.(bool)}, true
+			return []bool{value.(bool)}, true
 		}
 	}
 	return nil, false
@@ -920,12 +2005,17 @@ func (c *XConfig) GetBoolCollection(key string) ([]bool, bool) {
 // GetIntCollection will return the key entry data as a []int, or nil
 // return false as second parameter if the entry does not exists (remember a value can be nil and exists)
 func (c *XConfig) GetIntCollection(key string) ([]int, bool) {
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
 		case []int:
-			return val.Value.([]int), true
+			return value.([]int), true
+		case []interface{}:
+			// explicitly empty array
+			if len(value.([]interface{})) == 0 {
+				return []int{}, true
+			}
 		case int:
-			return []int{val.Value.(int)}, true
+			return []int{value.(int)}, true
 		}
 	}
 	return nil, false
@@ -934,12 +2024,17 @@ func (c *XConfig) GetIntCollection(key string) ([]int, bool) {
 // GetFloatCollection will return the key entry data as a []float64, or nil
 // return false as second parameter if the entry does not exists (remember a value can be nil and exists)
 func (c *XConfig) GetFloatCollection(key string) ([]float64, bool) {
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
 		case []float64:
-			return val.Value.([]float64), true
+			return value.([]float64), true
+		case []interface{}:
+			// explicitly empty array
+			if len(value.([]interface{})) == 0 {
+				return []float64{}, true
+			}
 		case float64:
-			return []float64{val.Value.(float64)}, true
+			return []float64{value.(float64)}, true
 		}
 	}
 	return nil, false
@@ -948,25 +2043,60 @@ func (c *XConfig) GetFloatCollection(key string) ([]float64, bool) {
 // GetTimeCollection will return the key entry data as a []Time, or nil
 // return false as second parameter if the entry does not exists (remember a value can be nil and exists)
 func (c *XConfig) GetTimeCollection(key string) ([]time.Time, bool) {
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
 		case []time.Time:
-			return val.Value.([]time.Time), true
+			return value.([]time.Time), true
+		case []interface{}:
+			// explicitly empty array
+			if len(value.([]interface{})) == 0 {
+				return []time.Time{}, true
+			}
 		case time.Time:
-			return []time.Time{val.Value.(time.Time)}, true
+			return []time.Time{value.(time.Time)}, true
+		}
+	}
+	return nil, false
+}
+
+// GetDurationCollection will return the key entry data as a []time.Duration, or nil
+// return false as second parameter if the entry does not exists (remember a value can be nil and exists)
+func (c *XConfig) GetDurationCollection(key string) ([]time.Duration, bool) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
+		case []time.Duration:
+			return value.([]time.Duration), true
+		case []interface{}:
+			// explicitly empty array
+			if len(value.([]interface{})) == 0 {
+				return []time.Duration{}, true
+			}
+		case time.Duration:
+			return []time.Duration{value.(time.Duration)}, true
 		}
 	}
 	return nil, false
 }
 
 // Del will delete then entry key it exists
+// The key can be a dotted path to a parameter of a sub XConfig, a sub XConfig is deleted with all its parameters,
+// and an element of a collection (server[1]) is removed from it
 func (c *XConfig) Del(key string) {
-	delete(c.Parameters, key)
-	delete(c.Comments, key)
+	if l, index, ok := c.locateelement(key); ok {
+		*l = append((*l)[:index], (*l)[index+1:]...)
+		return
+	}
+	config, key, ok := c.locate(key)
+	if !ok {
+		return
+	}
+	delete(config.Parameters, key)
+	delete(config.Comments, key)
 	// deletes from Order and comments too
-	for idx, v := range c.Order {
+	for idx, v := range config.Order {
 		if v == key {
-			c.Order = append(c.Order[:idx], c.Order[idx+1:]...)
+			config.Order = append(config.Order[:idx], config.Order[idx+1:]...)
+			break
 		}
 	}
 }
@@ -976,6 +2106,7 @@ func (c *XConfig) Clone() xcore.XDatasetDef {
 	cloned := New()
 	for id, val := range c.Parameters {
 		cloned.Parameters[id] = *(&val).Clone()
+		cloned.attach(cloned.Parameters[id].Value)
 	}
 	for id, val := range c.Comments {
 		cloned.Comments[id] = val
@@ -983,17 +2114,18 @@ func (c *XConfig) Clone() xcore.XDatasetDef {
 	cloned.Order = make([]string, len(c.Order))
 	copy(cloned.Order, c.Order)
 	cloned.Multiple = c.Multiple
+	cloned.nointerpolation = c.nointerpolation
+	cloned.profiles = append([]string(nil), c.profiles...)
 	return cloned
 }
 
 // GetConfig will return the key entry data as a XConfig, or nil
 // This is similar to the GetDataset function
 func (c *XConfig) GetConfig(key string) *XConfig {
-	// check if key contains "." (subset of config)
-	if val, ok := c.Parameters[key]; ok {
-		switch val.Value.(type) {
+	if value, ok := c.value(key); ok {
+		switch value.(type) {
 		case *XConfig:
-			return val.Value.(*XConfig)
+			return value.(*XConfig)
 		}
 	}
 	return nil
@@ -1001,92 +2133,559 @@ func (c *XConfig) GetConfig(key string) *XConfig {
 
 // LoadFile will try to load the file and parse it into the XConfig structure
 func (c *XConfig) LoadFile(filename string) error {
-	return c.loadandparse(filename, false)
+	return c.loadandparse(filename, false, "")
 }
 
 // MergeFile will try to load the file and parse it into the XConfig structure, merging the entries to the existing ones
 func (c *XConfig) MergeFile(filename string) error {
-	return c.loadandparse(filename, true)
+	return c.loadandparse(filename, true, "")
 }
 
 // LoadString will parse the string into the XConfig structure
 func (c *XConfig) LoadString(data string) error {
-	return c.parsestring(data, false)
+	return c.parsestring(data, false, "")
 }
 
 // MergeString will parse the string into the XConfig structure, merging the entries to the existing ones
 func (c *XConfig) MergeString(data string) error {
-	return c.parsestring(data, true)
+	return c.parsestring(data, true, "")
 }
 
 // LoadXConfig will load the new XConfig into the existing one
 func (c *XConfig) LoadXConfig(data *XConfig) error {
-	return c.parsemap(data, false)
+	return c.atomically(func(config *XConfig) error {
+		return config.parsemap(data, false)
+	})
 }
 
 // MergeXConfig will merge the new XConfig to the existing one
 func (c *XConfig) MergeXConfig(data *XConfig) error {
-	return c.parsemap(data, true)
+	return c.atomically(func(config *XConfig) error {
+		return config.parsemap(data, true)
+	})
+}
+
+// build returns the values of the parameter as written into a config file, one per line.
+// The values written into an inline array are kept together, and an array of less than 2 values is always written as an inline array.
+// The values that come from an included file are not written, the include directive is written instead.
+func (p *Parameter) build() []string {
+	elements := p.elements()
+	if len(elements) == 0 {
+		if p.paramtype >= 10 {
+			return []string{"[]"}
+		}
+		return []string{p.format(0, p.Value)}
+	}
+	indexes := []int{}
+	for i := range elements {
+		if i >= len(p.meta) || p.meta[i].include == "" {
+			indexes = append(indexes, i)
+		}
+	}
+	values := []string{}
+	inline := []string{}
+	for _, i := range indexes {
+		if p.paramtype > 10 && (len(indexes) == 1 || i < len(p.meta) && p.meta[i].inline) {
+			inline = append(inline, p.formatelement(i, elements[i]))
+			continue
+		}
+		if len(inline) > 0 {
+			values = append(values, "["+strings.Join(inline, ", ")+"]")
+			inline = nil
+		}
+		values = append(values, p.format(i, elements[i]))
+	}
+	if len(inline) > 0 {
+		values = append(values, "["+strings.Join(inline, ", ")+"]")
+	}
+	return values
+}
+
+// included returns true if all the values of the parameter come from included files
+func (p *Parameter) included() bool {
+	elements := p.elements()
+	if len(elements) == 0 || len(p.meta) < len(elements) {
+		return false
+	}
+	for _, m := range p.meta[:len(elements)] {
+		if m.include == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// replacesinclude returns true if the values are not from an included file and replaced the values of an included file
+func (p *Parameter) replacesinclude() bool {
+	if p.included() {
+		return false
+	}
+	for _, layer := range p.overridden {
+		if layer.Origin.Operation == "@include" || layer.Origin.Operation == "@load" {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalOptions are the options to build the config string with MarshalWith
+type MarshalOptions struct {
+	// Sections writes the sub XConfig as [section] blocks instead of a.b.c= lines
+	Sections bool
 }
 
-func (c *XConfig) buildLevel(prefix string) string {
+// buildLevel builds the lines of the parameters of the XConfig, with the prefix of the sub XConfig.
+// If sections is true, the sub XConfig are not written (see buildSections)
+func (c *XConfig) buildLevel(prefix string, sections bool) []string {
 	sdata := []string{}
+	// block is true after the header of a [profile:name] block, the next parameters must be written after a [] line
+	block := false
 	for _, val := range c.Order {
 		if val[0] == '#' {
-			sdata = append(sdata, c.Comments[val])
-		} else {
-			switch c.Parameters[val].paramtype {
-			case 11:
-				a := c.Parameters[val].Value.([]string)
-				for _, v := range a {
-					sdata = append(sdata, prefix+val+"="+v)
-				}
-			case 12:
-				a := c.Parameters[val].Value.([]int)
-				for _, v := range a {
-					sdata = append(sdata, prefix+val+"="+strconv.Itoa(v))
-				}
-			case 13:
-				a := c.Parameters[val].Value.([]float64)
-				for _, v := range a {
-					sdata = append(sdata, prefix+val+"="+fmt.Sprint(v))
-				}
-			case 14:
-				a := c.Parameters[val].Value.([]bool)
-				for _, v := range a {
-					sdata = append(sdata, prefix+val+"="+fmt.Sprint(v))
+			comment := c.Comments[val]
+			if name, ok := sectionheader(comment); ok {
+				_, block = profileheader(name)
+			} else if _, _, ok := profilekey(comment); ok && prefix != "" {
+				// the key@profile lines of a sub XConfig are written with their path
+				comment = prefix + comment
+			}
+			sdata = append(sdata, comment)
+			continue
+		}
+		lines := c.buildParameter(prefix, val, sections)
+		if block && len(lines) > 0 {
+			sdata = append(sdata, "[]")
+			block = false
+		}
+		sdata = append(sdata, lines...)
+	}
+	return sdata
+}
+
+// buildParameter builds the lines of the parameter key, with the lines of its sub XConfig if sections is false
+func (c *XConfig) buildParameter(prefix string, val string, sections bool) []string {
+	sdata := []string{}
+	p := c.Parameters[val]
+	if p.paramtype == 21 {
+		if !sections {
+			a := p.Value.(*XConfig)
+			sdata = append(sdata, a.buildLevel(prefix+val+".", false)...)
+		}
+		return sdata
+	}
+	if p.written != nil && p.included() {
+		// the values of the included file replaced the values written into the source
+		p = *p.written
+	}
+	if p.paramtype == 22 {
+		if !sections {
+			// the XConfig without parameters to write are skipped, so the indexes are renumbered without holes
+			index := 0
+			for _, a := range *p.Value.(*XConfigCollection) {
+				element := prefix + val + "[" + strconv.Itoa(index) + "]."
+				lines := a.buildLevel(element, false)
+				sdata = append(sdata, lines...)
+				for _, line := range lines {
+					if strings.HasPrefix(line, element) {
+						index++
+						break
+					}
 				}
-			case 21:
-				a := c.Parameters[val].Value.(*XConfig)
-				sdata = append(sdata, a.buildLevel(prefix+val+"."))
-			default:
-				sdata = append(sdata, prefix+val+"="+fmt.Sprint(c.Parameters[val].Value))
 			}
 		}
+		return sdata
+	}
+	// only the first line of an array gets the forced operator and the inline comment, the next ones are just added to it
+	operator := p.operator()
+	if operator == "=" && p.replacesinclude() {
+		// the value is written after the include directive, it must still replace the included value when the file is loaded again
+		operator = ":="
+	}
+	comment := c.Comments[val]
+	for _, value := range p.build() {
+		line := prefix + val + operator + value
+		if comment != "" {
+			line += " " + comment
+		}
+		sdata = append(sdata, line)
+		operator = "="
+		comment = ""
+	}
+	return sdata
+}
+
+// buildSections builds the lines of the sub XConfig as [section] blocks, after the parameters of the root level
+func (c *XConfig) buildSections(section string) []string {
+	sdata := c.buildLevel("", true)
+	// the header of a section whose parameters all come from included files is not written
+	if section != "" && (len(sdata) > 0 || len(c.Parameters) == 0) {
+		sdata = append([]string{"[" + section + "]"}, sdata...)
+	}
+	for _, val := range c.Order {
+		p, ok := c.Parameters[val]
+		if !ok || p.paramtype < 21 {
+			continue
+		}
+		name := val
+		if section != "" {
+			name = section + "." + val
+		}
+		if p.paramtype == 21 {
+			sdata = append(sdata, p.Value.(*XConfig).buildSections(name)...)
+			continue
+		}
+		// each XConfig of the collection is a [[name]] block, its sub XConfig are written as dotted keys
+		for _, a := range *p.Value.(*XConfigCollection) {
+			lines := a.buildLevel("", false)
+			if len(lines) == 0 && len(a.Parameters) > 0 {
+				// all the parameters come from included files
+				continue
+			}
+			sdata = append(sdata, "[["+name+"]]")
+			sdata = append(sdata, lines...)
+		}
 	}
-	return strings.Join(sdata, "\n")
+	return sdata
 }
 
+// Marshal will create the config string of the XConfig, with its comments, that can be saved and loaded again
 func (c *XConfig) Marshal() string {
-	return c.buildLevel("") + "\n"
+	return c.MarshalWith(MarshalOptions{})
+}
+
+// MarshalWith will create the config string of the XConfig with the options
+func (c *XConfig) MarshalWith(opts MarshalOptions) string {
+	if opts.Sections {
+		return strings.Join(c.buildSections(""), "\n") + "\n"
+	}
+	return strings.Join(c.buildLevel("", false), "\n") + "\n"
 }
 
+// SaveFile will save the config string of the XConfig (see Marshal) into the file
 func (c *XConfig) SaveFile(filename string) error {
 	data := c.Marshal()
 	return ioutil.WriteFile(filename, []byte(data), 0x644)
 }
 
-func analyzeKey(key string) (interface{}, bool) {
-	mustmerge := false
-	if key[len(key)-1] == '+' {
-		mustmerge = true
-		key = key[0 : len(key)-1]
+// parsevalue reads a single line value with its optional quotes and inline comment.
+// It returns the type and the value, the notation of the value if it was quoted, and the comment.
+func parsevalue(strvalue string) (int, interface{}, string, string, error) {
+	if len(strvalue) > 0 && strvalue[0] == '"' {
+		// a "quoted string" with escaped characters, maybe followed by a comment
+		if end := closingquote(strvalue); end > 0 {
+			rest := strings.TrimSpace(strvalue[end+1:])
+			if rest == "" || rest[0] == '#' || rest[0] == ';' {
+				value, err := strconv.Unquote(strvalue[:end+1])
+				if err != nil {
+					return 0, nil, "", "", errors.New("The quoted string contains an invalid escape sequence")
+				}
+				return 1, value, strvalue[:end+1], rest, nil
+			}
+		}
+	}
+	if len(strvalue) > 0 && strvalue[0] == '"' {
+		// a single leading " only means the value is a string, the rest of the line is the string (legacy form, no comment)
+		return 1, strvalue[1:], strvalue, "", nil
+	}
+	strvalue, comment := splitcomment(strvalue)
+	typeparam, value := infervalue(strvalue)
+	notation := ""
+	if typeparam == 2 || typeparam == 3 || typeparam == 7 || typeparam == 8 {
+		// the numbers keep their original notation (hexadecimal, separators, sizes...)
+		if (&Parameter{}).format(0, value) != strvalue {
+			notation = strvalue
+		}
+	}
+	return typeparam, value, notation, comment, nil
+}
+
+// parseinteger reads an integer: decimal, 0x hexadecimal, 0o octal or 0b binary, with optional _ separators.
+// It returns the type of the value: 2 (int), 7 (int64) or 8 (uint64), the smallest one containing the value
+func parseinteger(strvalue string) (int, interface{}, bool) {
+	digits := strings.TrimLeft(strvalue, "+-")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' {
+		return 0, nil, false
+	}
+	// the base is given by the prefix, a decimal number starting with 0 is not an octal number
+	base := 0
+	if len(digits) > 1 && digits[0] == '0' && !strings.ContainsAny(digits[1:2], "xXoObB") {
+		base = 10
+		// ParseInt only accepts the _ separators with the base 0, they must be between two digits
+		if strings.Contains(digits, "__") || strings.HasSuffix(digits, "_") {
+			return 0, nil, false
+		}
+		strvalue = strings.Replace(strvalue, "_", "", -1)
+	}
+	if intvalue, err := strconv.ParseInt(strvalue, base, 64); err == nil {
+		typeparam, value := integer(intvalue)
+		return typeparam, value, true
+	}
+	if strvalue[0] != '-' {
+		if uintvalue, err := strconv.ParseUint(strings.TrimPrefix(strvalue, "+"), base, 64); err == nil {
+			return 8, uintvalue, true
+		}
+	}
+	return 0, nil, false
+}
+
+// integer returns the int value if the int64 value is into the int range, or the int64 value
+func integer(value int64) (int, interface{}) {
+	if int64(int(value)) == value {
+		return 2, int(value)
+	}
+	return 7, value
+}
+
+// sizeUnits are the multipliers of the byte size units, SI (powers of 1000) and IEC (powers of 1024)
+var sizeUnits = map[string]float64{
+	"B":  1,
+	"kB": 1e3, "KB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12, "PB": 1e15, "EB": 1e18,
+	"KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30, "TiB": 1 << 40, "PiB": 1 << 50, "EiB": 1 << 60,
+}
+
+// parsesize reads a byte size with a unit (512MB, 1.5GiB) and returns it as an integer number of bytes
+func parsesize(strvalue string) (int, interface{}, bool) {
+	pos := strings.IndexFunc(strvalue, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.' || r == '_')
+	})
+	if pos <= 0 {
+		return 0, nil, false
+	}
+	multiplier, ok := sizeUnits[strings.TrimSpace(strvalue[pos:])]
+	if !ok {
+		return 0, nil, false
+	}
+	number := strings.Replace(strvalue[:pos], "_", "", -1)
+	if uintvalue, err := strconv.ParseUint(number, 10, 64); err == nil {
+		// exact computation for the integers
+		hi, size := bits.Mul64(uintvalue, uint64(multiplier))
+		if hi != 0 {
+			return 0, nil, false
+		}
+		if size > math.MaxInt64 {
+			return 8, size, true
+		}
+		typeparam, value := integer(int64(size))
+		return typeparam, value, true
+	}
+	floatvalue, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, nil, false
 	}
-	if key[len(key)-1] == ':' {
-		key = key[0 : len(key)-1]
+	size := floatvalue * multiplier
+	if size != math.Trunc(size) || size >= math.MaxInt64 {
+		return 0, nil, false
 	}
+	typeparam, value := integer(int64(size))
+	return typeparam, value, true
+}
 
-	match, _ := regexp.MatchString("[a-zA-Z0-9_-]+", key)
-	return match, mustmerge
+// parsearray reads an inline array [a, b, c] with its optional comment, and returns true if the value is an inline array.
+// The values are added with the same rules as the repeated keys, and [] is an empty array.
+func parsearray(strvalue string) (int, interface{}, []valuemeta, string, bool, error) {
+	if len(strvalue) == 0 || strvalue[0] != '[' {
+		return 0, nil, nil, "", false, nil
+	}
+	p := newParam()
+	i := 1
+	for {
+		for i < len(strvalue) && (strvalue[i] == ' ' || strvalue[i] == '\t') {
+			i++
+		}
+		if i >= len(strvalue) {
+			return 0, nil, nil, "", false, nil
+		}
+		if strvalue[i] == ']' {
+			// end of the array, after a , or empty array
+			i++
+			break
+		}
+		start := i
+		if strvalue[i] == '"' {
+			if end := closingquote(strvalue[i:]); end > 0 {
+				i += end + 1
+			}
+		}
+		for i < len(strvalue) && strvalue[i] != ',' && strvalue[i] != ']' {
+			i++
+		}
+		if i >= len(strvalue) {
+			return 0, nil, nil, "", false, nil
+		}
+		typeparam, value, notation, _, err := parsevalue(strings.TrimSpace(strvalue[start:i]))
+		if err == nil {
+			err = p.add(typeparam, value, 0, []valuemeta{{notation: notation, inline: true}})
+		}
+		if err != nil {
+			return 0, nil, nil, "", true, err
+		}
+		i++
+		if strvalue[i-1] == ']' {
+			break
+		}
+	}
+	comment := strings.TrimSpace(strvalue[i:])
+	if comment != "" && comment[0] != '#' && comment[0] != ';' {
+		return 0, nil, nil, "", false, nil
+	}
+	p.toarray()
+	return p.paramtype, p.Value, p.meta, comment, true, nil
+}
 
+// infervalue returns the type and the value of an unquoted value
+func infervalue(strvalue string) (int, interface{}) {
+	if strvalue == "yes" || strvalue == "true" || strvalue == "on" {
+		return 4, true
+	}
+	if strvalue == "no" || strvalue == "none" || strvalue == "false" || strvalue == "off" {
+		return 4, false
+	}
+	if typeparam, intvalue, ok := parseinteger(strvalue); ok {
+		return typeparam, intvalue
+	}
+	if floatvalue, err := strconv.ParseFloat(strvalue, 64); err == nil {
+		return 3, floatvalue
+	}
+	if typeparam, size, ok := parsesize(strvalue); ok {
+		return typeparam, size
+	}
+	for _, format := range timeFormats {
+		if timevalue, err := time.Parse(format, strvalue); err == nil {
+			return 5, timevalue
+		}
+	}
+	if durationvalue, err := time.ParseDuration(strvalue); err == nil {
+		return 6, durationvalue
+	}
+	return 1, strvalue
+}
+
+// closingquote returns the position of the " closing the quoted string, or -1
+func closingquote(strvalue string) int {
+	for i := 1; i < len(strvalue); i++ {
+		switch strvalue[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// splitcomment separates the value from a # or ; comment preceded by a space
+func splitcomment(strvalue string) (string, string) {
+	for i := 1; i < len(strvalue); i++ {
+		if (strvalue[i] == '#' || strvalue[i] == ';') && (strvalue[i-1] == ' ' || strvalue[i-1] == '\t') {
+			return strings.TrimSpace(strvalue[:i]), strvalue[i:]
+		}
+	}
+	return strvalue, ""
+}
+
+// quote returns the string as written into a config file, quoted only if needed to be read back as the same string
+func quote(value string) string {
+	if value == "" {
+		return value
+	}
+	if strings.TrimSpace(value) != value || value[0] == '"' || strings.HasPrefix(value, "<<") || strings.HasSuffix(value, "\\") {
+		return strconv.Quote(value)
+	}
+	if value[0] == '[' && value[len(value)-1] == ']' {
+		// would be read as an inline array
+		return strconv.Quote(value)
+	}
+	if _, comment := splitcomment(value); comment != "" {
+		return strconv.Quote(value)
+	}
+	for _, r := range value {
+		if r < ' ' || r == 0x7f {
+			return strconv.Quote(value)
+		}
+	}
+	if typeparam, _ := infervalue(value); typeparam != 1 {
+		return "\"" + value
+	}
+	return value
+}
+
+// isparamline returns true if the line is a key=value line, and not a comment
+func isparamline(data string) bool {
+	return len(data) > 0 && data[0] != '#' && data[0] != ';' && strings.Contains(data, "=")
+}
+
+// sectionheader analyzes a [section] line.
+// It returns the name of the section, empty for [] (back to the root level), and true if the line is a section header
+func sectionheader(data string) (string, bool) {
+	data = strings.TrimSpace(data)
+	if len(data) < 2 || data[0] != '[' || data[len(data)-1] != ']' {
+		return "", false
+	}
+	return strings.TrimSpace(data[1 : len(data)-1]), true
+}
+
+// heredocTag returns the closing tag if the line opens a heredoc value (key=<<TAG), or an empty string
+func heredocTag(data string) string {
+	if !isparamline(data) {
+		return ""
+	}
+	value := strings.TrimSpace(data[strings.Index(data, "=")+1:])
+	if !strings.HasPrefix(value, "<<") || len(value) == 2 {
+		return ""
+	}
+	for _, r := range value[2:] {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return ""
+		}
+	}
+	return value[2:]
+}
+
+// continues returns true if the key=value line ends with a \ and continues on the next line
+func continues(data string) bool {
+	return isparamline(data) && strings.HasSuffix(data, "\\")
+}
+
+// multiline builds the string value of a heredoc or of a value written on various lines with a \
+func multiline(strvalue string) string {
+	if heredocTag("="+strvalue[:strings.Index(strvalue, "\n")]) != "" {
+		lines := strings.Split(strvalue, "\n")
+		return strings.Join(lines[1:len(lines)-1], "\n")
+	}
+	return strings.Replace(strvalue, "\\\n", "\n", -1)
+}
+
+// heredoc builds the heredoc notation of a multi-line string, with a closing tag not used into the string
+func heredoc(value string) string {
+	tag := "EOF"
+	lines := strings.Split(value, "\n")
+	for i := 1; ; i++ {
+		used := false
+		for _, l := range lines {
+			if strings.TrimSpace(l) == tag {
+				used = true
+				break
+			}
+		}
+		if !used {
+			break
+		}
+		tag = "EOF" + strconv.Itoa(i)
+	}
+	return "<<" + tag + "\n" + value + "\n" + tag
+}
+
+// analyzeKey separates the key from the + or : forced assignment sign
+// and returns the clean key with the assignment: 0 for =, 1 for := and 2 for +=
+func analyzeKey(key string) (string, int) {
+	assignment := 0
+	switch key[len(key)-1] {
+	case '+':
+		assignment = 2
+		key = key[:len(key)-1]
+	case ':':
+		assignment = 1
+		key = key[:len(key)-1]
+	}
+	return strings.TrimSpace(key), assignment
 }
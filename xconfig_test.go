@@ -1,9 +1,20 @@
 package xconfig
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/webability-go/xcore/v2"
 )
 
 func TestLoads(t *testing.T) {
@@ -225,3 +236,1636 @@ func TestDel(t *testing.T) {
 		t.Errorf("The parameter has not been correctly deleted")
 	}
 }
+
+func TestAssignmentOperators(t *testing.T) {
+	conf := New()
+	conf.LoadString("param1=value1\nparam2=1\nparam2=2\nparam3=abc")
+
+	// load mode: = replaces, += adds
+	err := conf.LoadString("param1+=value2\nparam2=3\nparam4+=new")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	arr, _ := conf.GetStringCollection("param1")
+	if len(arr) != 2 || arr[0] != "value1" || arr[1] != "value2" {
+		t.Errorf("The += operator did not add the value in load mode: %v", conf.Parameters["param1"].Value)
+	}
+	if v, _ := conf.GetInt("param2"); v != 3 {
+		t.Errorf("The = operator did not replace the value in load mode")
+	}
+
+	// merge mode: = adds, := replaces
+	err = conf.MergeString("param3:=def\nparam2=4")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if v, _ := conf.GetString("param3"); v != "def" {
+		t.Errorf("The := operator did not replace the value in merge mode")
+	}
+	if v, _ := conf.GetIntCollection("param2"); len(v) != 2 || v[0] != 3 || v[1] != 4 {
+		t.Errorf("The = operator did not add the value in merge mode")
+	}
+
+	// the operators are kept by Marshal
+	conf2 := New()
+	conf2.LoadString("a+=1\na=2\nb:=x\nsub.c+=y")
+	if s := conf2.Marshal(); s != "a+=1\na=2\nb:=x\nsub.c+=y\n" {
+		t.Errorf("The operators are not correctly marshalled: %s", s)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	conf := New()
+	err := conf.LoadFile("testunit/error.conf")
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Errorf("The error is not a ParseError: %v", err)
+		return
+	}
+	if perr.File != "testunit/error.conf" || perr.Line != 4 || perr.Column != 11 || perr.Key != "param1" || perr.Text != "abc" {
+		t.Errorf("The ParseError is not correctly located: %#v", perr)
+	}
+	if perr.Error() != `testunit/error.conf:4:11: parameter "param1": value "abc": The parameter cannot add an incompatible value to an integer` {
+		t.Errorf("The ParseError message is not correct: %s", perr)
+	}
+
+	// strings count the lines from 1 too
+	err = conf.LoadString("param1=1\nparam1=true")
+	if !errors.As(err, &perr) || perr.File != "" || perr.Line != 2 {
+		t.Errorf("The ParseError of a string is not correctly located: %v", err)
+	}
+
+	// the conflicts found while merging into the XConfig are located, and the XConfig is not changed
+	merged := New()
+	merged.LoadString("a=1\nport=80\n")
+	err = merged.MergeFile("testunit/conflict.conf")
+	if !errors.As(err, &perr) || perr.File != "testunit/conflict.conf" || perr.Line != 2 || perr.Column != 1 || perr.Key != "port" {
+		t.Errorf("The ParseError of a merge is not correctly located: %v", err)
+	}
+	if merged.Marshal() != "a=1\nport=80\n" {
+		t.Errorf("A failed merge should not change the XConfig:\n%s", merged.Marshal())
+	}
+}
+
+func TestMultiline(t *testing.T) {
+	conf := New()
+	err := conf.LoadFile("testunit/multiline.conf")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if v, _ := conf.GetString("certificate"); v != "-----BEGIN CERTIFICATE-----\nMIIBszCCAVmgAwIBAgIUQ\n-----END CERTIFICATE-----" {
+		t.Errorf("The heredoc value is not correctly set: %q", v)
+	}
+	if v, _ := conf.GetString("query"); v != "SELECT *\n  FROM users\n  WHERE id=1" {
+		t.Errorf("The continued value is not correctly set: %q", v)
+	}
+	if v, ok := conf.GetString("empty"); !ok || v != "" {
+		t.Errorf("The empty heredoc value is not correctly set: %q", v)
+	}
+	if v, _ := conf.GetBool("after"); !v {
+		t.Errorf("The parameter after the multi-line values is not correctly set")
+	}
+
+	// the multi-line values are written back in the same form
+	content, _ := ioutil.ReadFile("testunit/multiline.conf")
+	if s := conf.Marshal(); s != string(content) {
+		t.Errorf("The multi-line values are not correctly marshalled:\n%s", s)
+	}
+
+	// new multi-line values are written as heredoc
+	conf.Set("html", "<p>\nEOF\n</p>")
+	conf2 := New()
+	conf2.LoadString(conf.Marshal())
+	if v, _ := conf2.GetString("html"); v != "<p>\nEOF\n</p>" {
+		t.Errorf("The new multi-line value does not read back: %q", v)
+	}
+
+	err = New().LoadString("a=<<EOF\nabc\n")
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Line != 1 {
+		t.Errorf("The heredoc without closing tag should fail: %v", err)
+	}
+}
+
+func TestMarshalReload(t *testing.T) {
+	conf := New()
+	conf.LoadFile("testunit/a.conf")
+	conf2 := New()
+	err := conf2.LoadString(conf.Marshal())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if fmt.Sprint(conf) != fmt.Sprint(conf2) {
+		t.Errorf("The marshalled config does not read back the same values")
+	}
+}
+
+func TestQuotedStrings(t *testing.T) {
+	conf := New()
+	err := conf.LoadString(`param1="hello \"world\"\tandé\n" # a comment
+param2=value2 # inline comment
+param3=value3;not a comment
+param4="123 ; legacy string
+param5=""abc
+param6=http://example.com/#anchor
+param7="  spaces  "`)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	values := map[string]string{
+		"param1": "hello \"world\"\tandé\n",
+		"param2": "value2",
+		"param3": "value3;not a comment",
+		"param4": "123 ; legacy string",
+		"param5": "\"abc",
+		"param6": "http://example.com/#anchor",
+		"param7": "  spaces  ",
+	}
+	for key, expected := range values {
+		if v, _ := conf.GetString(key); v != expected {
+			t.Errorf("The parameter %s is not correctly set: %q", key, v)
+		}
+	}
+
+	// inline comments are kept, and new values are quoted when needed
+	conf.Set("param9", "a # b")
+	conf.Set("param10", "true")
+	conf.Set("param11", " lead")
+	s := conf.Marshal()
+	expected := `param1="hello \"world\"\tandé\n" # a comment
+param2=value2 # inline comment
+param3=value3;not a comment
+param4="123 ; legacy string
+param5=""abc
+param6=http://example.com/#anchor
+param7="  spaces  "
+param9="a # b"
+param10="true
+param11=" lead"
+`
+	if s != expected {
+		t.Errorf("The quoted strings are not correctly marshalled:\n%s", s)
+	}
+	conf2 := New()
+	conf2.LoadString(s)
+	if fmt.Sprint(conf) != fmt.Sprint(conf2) {
+		t.Errorf("The marshalled config does not read back the same values")
+	}
+
+	err = New().LoadString("param1=ok\nparam2=\"bad \\q escape\"")
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Line != 2 || perr.Key != "param2" {
+		t.Errorf("The invalid escape sequence is not reported: %v", err)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	conf := New()
+	err := conf.LoadFile("testunit/include/main.conf")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if v, _ := conf.GetConfig("database").GetString("user"); v != "admin" {
+		t.Errorf("The included file is not merged: %q", v)
+	}
+	if conf.GetConfig("language").GetConfig("en") == nil || conf.GetConfig("language").GetConfig("fr") == nil {
+		t.Errorf("The included glob files are not merged")
+	}
+	if v, _ := conf.GetInt("port"); v != 8080 {
+		t.Errorf("The loaded file did not replace the value: %d", v)
+	}
+
+	// the directives are kept instead of the included values, and port is written as into main.conf
+	if s := conf.Marshal(); s != "# main config\nname=main\n@include database.conf\n@include i18n/*.conf\nport=80\n@load local.conf\n" {
+		t.Errorf("The include directives are not correctly marshalled:\n%s", s)
+	}
+
+	// the sections whose values all come from the included files are not written
+	if s := conf.MarshalWith(MarshalOptions{Sections: true}); s != "# main config\nname=main\n@include database.conf\n@include i18n/*.conf\nport=80\n@load local.conf\n" {
+		t.Errorf("The include directives are not correctly marshalled with sections:\n%s", s)
+	}
+
+	// a value set over an included value still replaces it when the saved file is loaded again
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "database.conf"), []byte("database.host=localhost\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "main.conf"), []byte("@include database.conf\n"), 0644)
+	saved := New()
+	if err := saved.LoadFile(filepath.Join(dir, "main.conf")); err != nil {
+		t.Error(err)
+		return
+	}
+	saved.Set("database.host", "db.local")
+	if err := saved.SaveFile(filepath.Join(dir, "main.conf")); err != nil {
+		t.Error(err)
+		return
+	}
+	// SaveFile writes the file with the 0x644 mode
+	os.Chmod(filepath.Join(dir, "main.conf"), 0644)
+	reloaded := New()
+	if err := reloaded.LoadFile(filepath.Join(dir, "main.conf")); err != nil {
+		t.Error(err)
+		return
+	}
+	if host, _ := reloaded.Get("database.host"); host != "db.local" {
+		t.Errorf("The saved value should replace the included value: %v\n%s", host, saved.Marshal())
+	}
+
+	err = New().LoadFile("testunit/include/cycle1.conf")
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("The include cycle is not detected: %v", err)
+	}
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.File != "testunit/include/cycle1.conf" || perr.Line != 2 {
+		t.Errorf("The include error is not located into the including file: %v", err)
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	t.Setenv("XCONFIG_TEST_HOME", "/home/test")
+	conf := New()
+	err := conf.LoadFile("testunit/interpolation.conf")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	values := map[string]string{
+		"logdir":  "/var/app/logs",
+		"home":    "/home/test",
+		"title":   "Default title",
+		"literal": "${basedir}",
+		"cycle1":  "${cycle2}",
+	}
+	for key, expected := range values {
+		if v, _ := conf.GetString(key); v != expected {
+			t.Errorf("The parameter %s is not correctly interpolated: %q", key, v)
+		}
+	}
+	if v, _ := conf.GetConfig("database").GetString("dsn"); v != "admin@localhost" {
+		t.Errorf("The references of the sub XConfig are not correctly interpolated: %q", v)
+	}
+	if v, ok := conf.GetInt("port"); !ok || v != 8000 {
+		t.Errorf("The single reference does not keep the type of the referenced parameter: %v", v)
+	}
+	if _, err := conf.Interpolate("${cycle1}"); err == nil || !strings.Contains(err.Error(), "cyclic") {
+		t.Errorf("The reference cycle is not detected: %v", err)
+	}
+
+	// the templates are kept by Marshal
+	content, _ := ioutil.ReadFile("testunit/interpolation.conf")
+	if s := conf.Marshal(); s != string(content) {
+		t.Errorf("The templates are not kept by Marshal:\n%s", s)
+	}
+
+	conf.SetInterpolation(false)
+	if v, _ := conf.GetString("logdir"); v != "${basedir}/logs" {
+		t.Errorf("The interpolation is not disabled: %q", v)
+	}
+}
+
+func TestTimeParam(t *testing.T) {
+	conf := New()
+	err := conf.LoadString("param1=2021-11-16T10:30:00-06:00\nparam2=2021-11-16\nparam3=2021-11-16 10:30:00.5\nparam4=30s\nparam5=1h30m\nparam5=-5m\nparam6=2020-01-01\nparam6=2020-02-01T12:00:00Z")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if v, ok := conf.GetTime("param1"); !ok || !v.Equal(time.Date(2021, 11, 16, 16, 30, 0, 0, time.UTC)) {
+		t.Errorf("The RFC 3339 time is not correctly set: %v", v)
+	}
+	if v, ok := conf.GetTime("param2"); !ok || !v.Equal(time.Date(2021, 11, 16, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("The date is not correctly set: %v", v)
+	}
+	if v, ok := conf.GetDuration("param4"); !ok || v != 30*time.Second {
+		t.Errorf("The duration is not correctly set: %v", v)
+	}
+	if v, ok := conf.GetDurationCollection("param5"); !ok || len(v) != 2 || v[0] != 90*time.Minute || v[1] != -5*time.Minute {
+		t.Errorf("The array of durations is not correctly set: %v", v)
+	}
+	if v, ok := conf.GetTimeCollection("param6"); !ok || len(v) != 2 {
+		t.Errorf("The array of times is not correctly set: %v", v)
+	}
+	if err := conf.MergeString("param4=abc"); err == nil {
+		t.Errorf("A string should not be added to a duration")
+	}
+
+	s := conf.Marshal()
+	if s != "param1=2021-11-16T10:30:00-06:00\nparam2=2021-11-16\nparam3=2021-11-16T10:30:00.5Z\nparam4=30s\nparam5=1h30m0s\nparam5=-5m0s\nparam6=2020-01-01\nparam6=2020-02-01T12:00:00Z\n" {
+		t.Errorf("The times and durations are not correctly marshalled:\n%s", s)
+	}
+}
+
+func TestWideIntegers(t *testing.T) {
+	conf := New()
+	err := conf.LoadString("mode=0o755\nmask=0x1F\nflags=0b101\nbig=1_000_000\nold=0755\nhuge=18446744073709551615\nmemory=512MB\nbuffer=1.5KiB\nlimit=2 GiB\nneg=-0x10\nzero=01_000")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ints := map[string]int{"mode": 0755, "mask": 31, "flags": 5, "big": 1000000, "old": 755, "memory": 512000000, "buffer": 1536, "neg": -16, "zero": 1000}
+	for key, expected := range ints {
+		if v, ok := conf.GetInt(key); !ok || v != expected {
+			t.Errorf("The integer %s is not correctly set: %v", key, conf.Parameters[key].Value)
+		}
+	}
+	if v, ok := conf.GetUint64("huge"); !ok || v != math.MaxUint64 {
+		t.Errorf("The uint64 is not correctly set: %v", conf.Parameters["huge"].Value)
+	}
+	if _, ok := conf.GetInt64("huge"); ok {
+		t.Errorf("The uint64 out of the int64 range should not be returned as an int64")
+	}
+	if v, ok := conf.GetInt("huge"); ok || v != 0 {
+		t.Errorf("The uint64 out of the int range should not be returned as an int: %v", v)
+	}
+	if v, ok := conf.GetBytes("limit"); !ok || v != 2<<30 {
+		t.Errorf("The size is not correctly set: %v", v)
+	}
+	if _, ok := conf.GetBytes("neg"); ok {
+		t.Errorf("A negative integer is not a size")
+	}
+
+	// the integers of different types are added with the same type
+	mixed := New()
+	if err := mixed.LoadString("big=1\nbig=9223372036854775808\nwide=[-1, 2]\n"); err != nil {
+		t.Errorf("Error loading the mixed integers: %v", err)
+		return
+	}
+	if v, _ := Get[[]uint64](mixed, "big"); !reflect.DeepEqual(v, []uint64{1, 9223372036854775808}) {
+		t.Errorf("The int array should be widened to uint64: %#v", mixed.Parameters["big"].Value)
+	}
+	mixed.Add("wide", int64(3))
+	if v, _ := Get[[]int64](mixed, "wide"); !reflect.DeepEqual(v, []int64{-1, 2, 3}) {
+		t.Errorf("The int array should be widened to int64: %#v", mixed.Parameters["wide"].Value)
+	}
+	if err := mixed.Add("wide", uint64(math.MaxUint64)); err == nil {
+		t.Errorf("The negative and too large integers cannot be into the same array")
+	}
+	if s := mixed.Marshal(); s != "big=1\nbig=9223372036854775808\nwide=[-1, 2]\nwide=3\n" {
+		t.Errorf("The widened integers are not correctly written:\n%s", s)
+	}
+
+	conf.Set("count", int64(12))
+	s := conf.Marshal()
+	if s != "mode=0o755\nmask=0x1F\nflags=0b101\nbig=1_000_000\nold=0755\nhuge=18446744073709551615\nmemory=512MB\nbuffer=1.5KiB\nlimit=2 GiB\nneg=-0x10\nzero=01_000\ncount=12\n" {
+		t.Errorf("The integers do not keep their notation:\n%s", s)
+	}
+}
+
+func TestSections(t *testing.T) {
+	conf := New()
+	err := conf.LoadFile("testunit/sections.conf")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if v, _ := conf.GetConfig("database").GetString("user"); v != "admin" {
+		t.Errorf("The section parameter is not correctly set: %q", v)
+	}
+	if v, _ := conf.GetConfig("database").GetConfig("replica").GetString("host"); v != "replica.local" {
+		t.Errorf("The sub section parameter is not correctly set: %q", v)
+	}
+
+	// same structure as the dotted keys
+	conf2 := New()
+	conf2.LoadString("name=myapp\ndatabase.host=localhost\ndatabase.user=admin\ndatabase.replica.host=replica.local\nlanguage.en.welcome=Welcome")
+	if conf.Marshal() != "# global parameters\nname=myapp\n\n# the database connection\ndatabase.host=localhost\ndatabase.user=admin\n\ndatabase.replica.host=replica.local\n\nlanguage.en.welcome=Welcome\n" {
+		t.Errorf("The sections are not correctly marshalled as dotted keys:\n%s", conf.Marshal())
+	}
+
+	content, _ := ioutil.ReadFile("testunit/sections.conf")
+	if s := conf.MarshalWith(MarshalOptions{Sections: true}); s != string(content) {
+		t.Errorf("The sections are not correctly marshalled:\n%s", s)
+	}
+	if s := conf2.MarshalWith(MarshalOptions{Sections: true}); s != "name=myapp\n[database]\nhost=localhost\nuser=admin\n[database.replica]\nhost=replica.local\n[language.en]\nwelcome=Welcome\n" {
+		t.Errorf("The dotted keys are not correctly marshalled as sections:\n%s", s)
+	}
+
+	err = New().LoadString("name=myapp\n[name]\nhost=localhost")
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Line != 2 {
+		t.Errorf("A section on a parameter should fail: %v", err)
+	}
+}
+
+func TestInlineArray(t *testing.T) {
+	conf := New()
+	err := conf.LoadString("country=[MX, US, FR] # some countries\nports=[80,443]\nnames=[\"a, b\", \"c]\", d]\nsingle=[one]\nempty=[]\nlist=a\nlist=b\nnotarray=[abc")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if v, _ := conf.GetStringCollection("country"); len(v) != 3 || v[0] != "MX" || v[2] != "FR" {
+		t.Errorf("The inline array is not correctly set: %v", v)
+	}
+	if v, _ := conf.GetIntCollection("ports"); len(v) != 2 || v[1] != 443 {
+		t.Errorf("The inline array of integers is not correctly set: %v", v)
+	}
+	if v, _ := conf.GetStringCollection("names"); len(v) != 3 || v[0] != "a, b" || v[1] != "c]" || v[2] != "d" {
+		t.Errorf("The inline array of quoted strings is not correctly set: %v", v)
+	}
+	if v, _ := conf.Get("single"); fmt.Sprint(v) != "[one]" {
+		t.Errorf("The inline array of one value is not an array: %#v", v)
+	}
+	if v, ok := conf.GetStringCollection("empty"); !ok || v == nil || len(v) != 0 {
+		t.Errorf("The empty array is not correctly set: %#v", v)
+	}
+	if v, _ := conf.GetString("notarray"); v != "[abc" {
+		t.Errorf("An unclosed array should be a string: %q", v)
+	}
+
+	// type checked as repeated keys
+	if err := New().LoadString("mixed=[1, abc]"); err == nil {
+		t.Errorf("An inline array with mixed types should fail")
+	}
+
+	// an empty array in a load overlay empties the list
+	conf.LoadString("country=[]\nempty=[1, 2]")
+	if v, ok := conf.GetStringCollection("country"); !ok || len(v) != 0 {
+		t.Errorf("The empty array did not replace the list: %v", v)
+	}
+
+	s := conf.Marshal()
+	if s != "country=[] # some countries\nports=[80, 443]\nnames=[\"a, b\", \"c]\", d]\nsingle=[one]\nempty=[1, 2]\nlist=a\nlist=b\nnotarray=[abc\n" {
+		t.Errorf("The inline arrays are not correctly marshalled:\n%s", s)
+	}
+}
+
+func TestDottedPath(t *testing.T) {
+	conf := New()
+	err := conf.LoadString("language.en.welcome=Welcome\nlanguage.fr.welcome=Bienvenue\nlanguage.en.port=80")
+	if err != nil {
+		t.Errorf("Error parsing the dotted keys: %v", err)
+		return
+	}
+	if v, ok := conf.GetString("language.en.welcome"); !ok || v != "Welcome" {
+		t.Errorf("The dotted path is not resolved by GetString: %q", v)
+	}
+	if v, ok := conf.GetInt("language.en.port"); !ok || v != 80 {
+		t.Errorf("The dotted path is not resolved by GetInt: %v", v)
+	}
+	if _, ok := conf.Get("language.de.welcome"); ok {
+		t.Errorf("A missing dotted path should not be found")
+	}
+	if _, ok := conf.Get("language.en.welcome.text"); ok {
+		t.Errorf("A dotted path through a string should not be found")
+	}
+	if sub := conf.GetConfig("language.fr"); sub == nil {
+		t.Errorf("The dotted path is not resolved by GetConfig")
+	}
+
+	conf.Set("server.http.port", 8080)
+	if v, ok := conf.GetInt("server.http.port"); !ok || v != 8080 {
+		t.Errorf("Set did not create the intermediate sub configs: %v", v)
+	}
+	if _, ok := conf.Parameters["server.http.port"]; ok {
+		t.Errorf("Set created a flat dotted key")
+	}
+	// the empty keys are ignored by Set and rejected by Add
+	before := conf.Marshal()
+	for _, key := range []string{"a.", ".a", "server..port", ""} {
+		conf.Set(key, 1)
+		if err := conf.Add(key, 1); err == nil {
+			t.Errorf("Add should reject the empty key of %q", key)
+		}
+	}
+	if conf.Marshal() != before {
+		t.Errorf("The empty keys should not change the config:\n%s", conf.Marshal())
+	}
+	conf.Add("language.en.alias", "Hello")
+	conf.Add("language.en.alias", "Hi")
+	if v, ok := conf.GetStringCollection("language.en.alias"); !ok || len(v) != 2 {
+		t.Errorf("Add did not build the collection in the sub config: %v", v)
+	}
+
+	conf.Del("language.en.port")
+	if _, ok := conf.Get("language.en.port"); ok {
+		t.Errorf("Del did not delete the dotted path")
+	}
+	conf.Del("language.fr")
+	if _, ok := conf.Get("language.fr.welcome"); ok {
+		t.Errorf("Del did not delete the sub config")
+	}
+
+	s := conf.Marshal()
+	back := New()
+	if err := back.LoadString(s); err != nil {
+		t.Errorf("Error reloading the marshalled dotted keys: %v", err)
+	}
+	if v, _ := back.GetInt("server.http.port"); v != 8080 {
+		t.Errorf("The dotted keys do not reload:\n%s", s)
+	}
+}
+
+func TestGetE(t *testing.T) {
+	conf := New()
+	err := conf.LoadString("name=webability\nport=80\nratio=1.5\nround=3.0\nhuge=18446744073709551615\nlist=a\nlist=b\nsize=1KiB\nmissing=${nothere}\nsub.key=value")
+	if err != nil {
+		t.Errorf("Error parsing the config: %v", err)
+		return
+	}
+	if v, err := conf.GetIntE("port"); err != nil || v != 80 {
+		t.Errorf("GetIntE returned %v, %v", v, err)
+	}
+	if v, err := conf.GetIntE("round"); err != nil || v != 3 {
+		t.Errorf("GetIntE of an integral float returned %v, %v", v, err)
+	}
+	if _, err := conf.GetIntE("nothere"); err != ErrNotFound {
+		t.Errorf("GetIntE of a missing key should return ErrNotFound: %v", err)
+	}
+	if _, err := conf.GetIntE("sub.nothere"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetIntE of a missing path should return ErrNotFound: %v", err)
+	}
+
+	_, err = conf.GetIntE("name")
+	var te *TypeError
+	if !errors.As(err, &te) || te.Key != "name" || te.Expected != "int" || te.Actual != "string" {
+		t.Errorf("GetIntE of a string should return a TypeError: %v", err)
+	}
+	_, err = conf.GetStringE("list")
+	if !errors.As(err, &te) || te.Expected != "string" || te.Actual != "array of string" {
+		t.Errorf("GetStringE of an array should return a TypeError: %v", err)
+	}
+	if _, err := conf.GetStringE("sub"); !errors.As(err, &te) || te.Actual != "XConfig" {
+		t.Errorf("GetStringE of a sub XConfig should return a TypeError: %v", err)
+	}
+
+	_, err = conf.GetIntE("ratio")
+	var ce *ConversionError
+	if !errors.As(err, &ce) || !errors.Is(err, ErrPrecision) || ce.Expected != "int" {
+		t.Errorf("GetIntE of a float with decimals should return a precision ConversionError: %v", err)
+	}
+	if _, err := conf.GetInt64E("huge"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("GetInt64E of a too big uint64 should return ErrOverflow: %v", err)
+	}
+	if v, err := conf.GetUint64E("huge"); err != nil || v != math.MaxUint64 {
+		t.Errorf("GetUint64E returned %v, %v", v, err)
+	}
+	conf.Set("negative", -1)
+	if _, err := conf.GetUint64E("negative"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("GetUint64E of a negative should return ErrOverflow: %v", err)
+	}
+	conf.Set("big", 1e30)
+	if _, err := conf.GetInt64E("big"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("GetInt64E of a too big float should return ErrOverflow: %v", err)
+	}
+
+	if v, err := conf.GetBytesE("size"); err != nil || v != 1024 {
+		t.Errorf("GetBytesE returned %v, %v", v, err)
+	}
+	if v, err := conf.GetStringCollectionE("list"); err != nil || len(v) != 2 {
+		t.Errorf("GetStringCollectionE returned %v, %v", v, err)
+	}
+	if _, err := conf.GetIntCollectionE("list"); !errors.As(err, &te) || te.Actual != "array of string" {
+		t.Errorf("GetIntCollectionE of strings should return a TypeError: %v", err)
+	}
+	if _, err := conf.GetStringE("missing"); err == nil {
+		t.Errorf("GetStringE should return the error of an unresolved reference")
+	}
+	if v, err := conf.GetConfigE("sub"); err != nil || v == nil {
+		t.Errorf("GetConfigE returned %v, %v", v, err)
+	}
+}
+
+func TestGeneric(t *testing.T) {
+	conf := New()
+	err := conf.LoadString("server.port=8080\nserver.host=localhost\nratio=1.5\ntimeout=30s\nlist=a\nlist=b\nstart=2026-01-02")
+	if err != nil {
+		t.Errorf("Error parsing the config: %v", err)
+		return
+	}
+	if v, err := Get[int](conf, "server.port"); err != nil || v != 8080 {
+		t.Errorf("Get[int] returned %v, %v", v, err)
+	}
+	if v, err := Get[float64](conf, "server.port"); err != nil || v != 8080 {
+		t.Errorf("Get[float64] of an int returned %v, %v", v, err)
+	}
+	if _, err := Get[int](conf, "ratio"); !errors.Is(err, ErrPrecision) {
+		t.Errorf("Get[int] of a float with decimals should fail: %v", err)
+	}
+	if v, err := Get[time.Duration](conf, "timeout"); err != nil || v != 30*time.Second {
+		t.Errorf("Get[time.Duration] returned %v, %v", v, err)
+	}
+	if v, err := Get[time.Time](conf, "start"); err != nil || v.Year() != 2026 {
+		t.Errorf("Get[time.Time] returned %v, %v", v, err)
+	}
+	if v, err := Get[[]string](conf, "list"); err != nil || len(v) != 2 {
+		t.Errorf("Get[[]string] returned %v, %v", v, err)
+	}
+	wide := New()
+	wide.LoadString("big=[9223372036854775807, 1]\nhuge=[18446744073709551615, 18446744073709551614]\nsmall=[1, 2]\nneg=-1")
+	if v, err := Get[[]int64](wide, "big"); err != nil || !reflect.DeepEqual(v, []int64{math.MaxInt64, 1}) {
+		t.Errorf("Get[[]int64] returned %v, %v", v, err)
+	}
+	if v, err := Get[[]uint64](wide, "huge"); err != nil || !reflect.DeepEqual(v, []uint64{math.MaxUint64, math.MaxUint64 - 1}) {
+		t.Errorf("Get[[]uint64] returned %v, %v", v, err)
+	}
+	if v, err := Get[[]int64](wide, "small"); err != nil || !reflect.DeepEqual(v, []int64{1, 2}) {
+		t.Errorf("Get[[]int64] of an array of int returned %v, %v", v, err)
+	}
+	if _, err := Get[[]uint64](wide, "neg"); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Get[[]uint64] of a negative integer should fail: %v", err)
+	}
+	if v, err := Get[*XConfig](conf, "server"); err != nil || v == nil {
+		t.Errorf("Get[*XConfig] returned %v, %v", v, err)
+	}
+	if v, err := Get[interface{}](conf, "server.host"); err != nil || v != "localhost" {
+		t.Errorf("Get[interface{}] returned %v, %v", v, err)
+	}
+	var te *TypeError
+	if _, err := Get[uint8](conf, "server.port"); !errors.As(err, &te) || te.Expected != "uint8" || te.Actual != "int" {
+		t.Errorf("Get[uint8] should return a TypeError: %v", err)
+	}
+	if _, err := Get[fmt.Stringer](conf, "server.port"); !errors.As(err, &te) || te.Expected != "fmt.Stringer" {
+		t.Errorf("Get[fmt.Stringer] should return a TypeError: %v", err)
+	}
+
+	if v := GetOr(conf, "server.port", 80); v != 8080 {
+		t.Errorf("GetOr of an existing entry returned %v", v)
+	}
+	if v := GetOr(conf, "client.port", 80); v != 80 {
+		t.Errorf("GetOr of a missing entry returned %v", v)
+	}
+	if v := GetOr(conf, "server.host", 80); v != 80 {
+		t.Errorf("GetOr of a string as an int returned %v", v)
+	}
+
+	if v := MustGet[string](conf, "server.host"); v != "localhost" {
+		t.Errorf("MustGet returned %v", v)
+	}
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("MustGet of a missing entry should panic")
+		}
+	}()
+	MustGet[string](conf, "server.nothere")
+}
+
+type level int
+
+func (l *level) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = 1
+	case "error":
+		*l = 2
+	default:
+		return fmt.Errorf("unknown level %s", text)
+	}
+	return nil
+}
+
+type decodeDatabase struct {
+	Host string `xconfig:"host,required"`
+	Port int    `xconfig:"port"`
+	User string
+}
+
+type decodeBase struct {
+	Name string `xconfig:"name"`
+}
+
+type decodeSettings struct {
+	decodeBase
+	Database decodeDatabase    `xconfig:"database"`
+	Replica  *decodeDatabase   `xconfig:"replica"`
+	Cache    decodeDatabase    `xconfig:"cache"`
+	Timeout  time.Duration     `xconfig:"timeout"`
+	Start    time.Time         `xconfig:"start"`
+	Hosts    []string          `xconfig:"hosts"`
+	Ports    []uint16          `xconfig:"ports"`
+	Labels   map[string]string `xconfig:"labels"`
+	Level    level             `xconfig:"level"`
+	Ratio    float32           `xconfig:"ratio"`
+	Debug    *bool             `xconfig:"debug"`
+	Host     string            `xconfig:"database.host"`
+	Default  int               `xconfig:"default"`
+	Ignored  string            `xconfig:"-"`
+	Raw      interface{}       `xconfig:"ratio"`
+}
+
+type inner int
+
+type decodeEmbedded struct {
+	inner
+	Name string `xconfig:"name"`
+}
+
+func TestDecode(t *testing.T) {
+	data := `name=app
+database.host=db.local
+database.port=5432
+database.USER=admin
+replica.host=replica.local
+cache.host=cache.local
+timeout=30s
+start=2026-01-02
+hosts=[a, b]
+ports=[80, 443]
+labels.env=prod
+labels.zone=eu
+level=debug
+ratio=0.5
+debug=yes
+`
+	s := decodeSettings{Default: 7, Ignored: "keep"}
+	if err := Unmarshal([]byte(data), &s); err != nil {
+		t.Errorf("Error decoding the config: %v", err)
+		return
+	}
+	if s.Name != "app" || s.Database.Host != "db.local" || s.Database.Port != 5432 || s.Database.User != "admin" {
+		t.Errorf("The structure is not correctly decoded: %+v", s)
+	}
+	if s.Replica == nil || s.Replica.Host != "replica.local" {
+		t.Errorf("The pointer to a structure is not decoded: %+v", s.Replica)
+	}
+	if s.Timeout != 30*time.Second || s.Start.Year() != 2026 || s.Ratio != 0.5 || s.Level != 1 || s.Host != "db.local" {
+		t.Errorf("The values are not correctly decoded: %+v", s)
+	}
+	if len(s.Hosts) != 2 || s.Hosts[1] != "b" || len(s.Ports) != 2 || s.Ports[1] != 443 {
+		t.Errorf("The slices are not correctly decoded: %v %v", s.Hosts, s.Ports)
+	}
+	if len(s.Labels) != 2 || s.Labels["zone"] != "eu" {
+		t.Errorf("The map is not correctly decoded: %v", s.Labels)
+	}
+	if s.Debug == nil || !*s.Debug {
+		t.Errorf("The pointer to a bool is not decoded: %v", s.Debug)
+	}
+	if s.Default != 7 || s.Ignored != "keep" || s.Raw != 0.5 {
+		t.Errorf("The default and ignored fields are not kept: %+v", s)
+	}
+
+	// the errors are aggregated
+	data = `database.port=99999
+ports=[80, 70000]
+level=verbose
+ratio=abc
+`
+	s = decodeSettings{}
+	err := Unmarshal([]byte(data), &s)
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Errorf("The decode should return a DecodeError: %v", err)
+		return
+	}
+	fields := []string{}
+	for _, fe := range de.Errors {
+		fields = append(fields, fe.Field+"="+fe.Key)
+	}
+	expected := "Database.Host=database.host,Cache.Host=cache.host,Ports=ports,Level=level,Ratio=ratio"
+	if strings.Join(fields, ",") != expected {
+		t.Errorf("The decode errors are not correctly reported: %s\n%v", strings.Join(fields, ","), err)
+	}
+	if !errors.Is(de.Errors[0], ErrNotFound) || !errors.Is(de.Errors[2], ErrOverflow) {
+		t.Errorf("The causes of the decode errors are not correct: %v", err)
+	}
+	if err := New().Decode(s); err == nil {
+		t.Errorf("Decode into a non pointer should fail")
+	}
+
+	// the comments of a section are not keys of the map
+	m := struct {
+		Labels map[string]string `xconfig:"labels"`
+	}{}
+	if err := Unmarshal([]byte("[labels]\n# a comment\n\na=b\n"), &m); err != nil || len(m.Labels) != 1 || m.Labels["a"] != "b" {
+		t.Errorf("The map of a commented section is not correctly decoded: %v %v", m.Labels, err)
+	}
+
+	// the unexported embedded fields that are not structures are ignored
+	e := decodeEmbedded{}
+	if err := Unmarshal([]byte("inner=5\nname=app\n"), &e); err != nil || e.inner != 0 || e.Name != "app" {
+		t.Errorf("The unexported embedded field is not ignored: %+v %v", e, err)
+	}
+}
+
+type encodeServer struct {
+	Host    string        `xconfig:"host" doc:"The name of the server"`
+	Port    uint16        `xconfig:"port,omitempty"`
+	Timeout time.Duration `xconfig:"timeout"`
+}
+
+type encodeSettings struct {
+	decodeBase
+	Server  encodeServer      `xconfig:"server" doc:"The HTTP server\nused by the API"`
+	Backup  *encodeServer     `xconfig:"backup,omitempty"`
+	Hosts   []string          `xconfig:"hosts"`
+	Empty   []int             `xconfig:"empty"`
+	Labels  map[string]string `xconfig:"labels"`
+	Ratio   float32           `xconfig:"ratio"`
+	Debug   bool              `xconfig:"debug,omitempty"`
+	Start   time.Time         `xconfig:"start"`
+	Admin   string            `xconfig:"users.admin.name"`
+	Ignored string            `xconfig:"-"`
+}
+
+func TestFromStruct(t *testing.T) {
+	s := encodeSettings{
+		decodeBase: decodeBase{Name: "app"},
+		Server:     encodeServer{Host: "localhost", Timeout: 30 * time.Second},
+		Hosts:      []string{"a", "b c"},
+		Empty:      []int{},
+		Labels:     map[string]string{"zone": "eu", "env": "prod"},
+		Ratio:      0.1,
+		Start:      time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+		Admin:      "root",
+		Ignored:    "nothing",
+	}
+	conf, err := FromStruct(&s)
+	if err != nil {
+		t.Errorf("Error building the config: %v", err)
+		return
+	}
+	str := conf.Marshal()
+	expected := `name=app
+# The HTTP server
+# used by the API
+# The name of the server
+server.host=localhost
+server.timeout=30s
+hosts=a
+hosts=b c
+empty=[]
+labels.env=prod
+labels.zone=eu
+ratio=0.1
+start=2026-01-02
+users.admin.name=root
+`
+	if str != expected {
+		t.Errorf("The config built from the structure is not correct:\n%s", str)
+	}
+
+	// round trip
+	back := encodeSettings{}
+	if err := Unmarshal([]byte(str), &back); err != nil {
+		t.Errorf("Error decoding the config built from the structure: %v", err)
+	}
+	s.Ignored = ""
+	if !reflect.DeepEqual(s, back) {
+		t.Errorf("The structure does not round trip:\n%+v\n%+v", s, back)
+	}
+
+	if _, err := FromStruct(42); err == nil {
+		t.Errorf("FromStruct of an int should fail")
+	}
+	var fe *FieldError
+	if _, err := FromStruct(struct{ F func() }{}); !errors.As(err, &fe) || fe.Field != "F" {
+		t.Errorf("FromStruct of a func should return a FieldError: %v", err)
+	}
+	if c, err := FromStruct(decodeEmbedded{inner: 5, Name: "app"}); err != nil || c.Marshal() != "name=app\n" {
+		t.Errorf("FromStruct should ignore the unexported embedded field: %v", err)
+	}
+}
+
+func TestCollection(t *testing.T) {
+	conf := New()
+	err := conf.LoadFile("testunit/collection.conf")
+	if err != nil {
+		t.Errorf("Error parsing the collections: %v", err)
+		return
+	}
+	col, ok := conf.GetCollection("server")
+	if !ok || col.Count() != 2 {
+		t.Errorf("The collection is not correctly built: %v", col)
+		return
+	}
+	if ds, ok := col.Get(1); !ok || ds.(*XConfig).GetConfig("tls") == nil {
+		t.Errorf("The section after a repeated section is not into the last element: %v", ds)
+	}
+	if v, _ := col.GetDataString("host"); v != "beta.local" {
+		t.Errorf("GetDataString should return the value of the last element: %q", v)
+	}
+	if v, ok := conf.GetInt("server[0].weight"); !ok || v != 2 {
+		t.Errorf("The indexed path is not resolved: %v", v)
+	}
+	if v, ok := conf.GetString("server[1].tls.cert"); !ok || v != "beta.pem" {
+		t.Errorf("The indexed path with a sub XConfig is not resolved: %v", v)
+	}
+	if conf.GetConfig("server[1]") == nil || conf.GetConfig("server[2]") != nil {
+		t.Errorf("GetConfig of an element is not correct")
+	}
+	if v, _ := conf.GetString("database.replica[1].host"); v != "replica2.local" {
+		t.Errorf("The key[N] syntax is not correctly parsed: %q", v)
+	}
+	if v, _ := conf.GetString("database.main"); v != "alpha.local" {
+		t.Errorf("The reference to an element is not resolved: %q", v)
+	}
+	if err := New().LoadString("server[1].host=a"); err == nil {
+		t.Errorf("An index out of range should fail")
+	}
+
+	expected := `# the upstream servers
+name=api
+
+server[0].host=alpha.local
+server[0].weight=2
+
+server[1].host=beta.local
+server[1].weight=1
+# the tls of beta
+server[1].tls.cert=beta.pem
+
+database.replica[0].host=replica1.local
+database.replica[1].host=replica2.local
+database.main=${server[0].host}
+`
+	if s := conf.Marshal(); s != expected {
+		t.Errorf("The collections are not correctly marshalled:\n%s", s)
+	}
+	s := conf.MarshalWith(MarshalOptions{Sections: true})
+	back := New()
+	if err := back.LoadString(s); err != nil {
+		t.Errorf("Error reloading the collections as sections: %v\n%s", err, s)
+	}
+	for _, key := range []string{"name", "server[0].weight", "server[1].tls.cert", "database.replica[1].host", "database.main"} {
+		v1, _ := conf.Get(key)
+		v2, _ := back.Get(key)
+		if v1 != v2 {
+			t.Errorf("The collections as sections do not reload the same %s: %v\n%s", key, v2, s)
+		}
+	}
+
+	// merge appends, load replaces
+	clone := conf.Clone().(*XConfig)
+	clone.MergeString("[[server]]\nhost=gamma.local")
+	if col, _ := clone.GetCollection("server"); col.Count() != 3 {
+		t.Errorf("Merging a collection should append the elements: %v", col.Count())
+	}
+	if col, _ := conf.GetCollection("server"); col.Count() != 2 {
+		t.Errorf("The clone shares the collection with the original")
+	}
+	clone.LoadString("[[server]]\nhost=delta.local")
+	if col, _ := clone.GetCollection("server"); col.Count() != 1 {
+		t.Errorf("Loading a collection should replace the elements: %v", col.Count())
+	}
+
+	clone.Set("server[1].host", "epsilon.local")
+	clone.Del("server[0]")
+	if v, _ := clone.GetString("server[0].host"); v != "epsilon.local" {
+		t.Errorf("Set and Del of the elements are not correct: %v", clone.Marshal())
+	}
+}
+
+type collectionServer struct {
+	Host   string `xconfig:"host"`
+	Weight int    `xconfig:"weight,omitempty"`
+}
+
+type collectionSettings struct {
+	Servers []collectionServer `xconfig:"server"`
+}
+
+func TestCollectionStruct(t *testing.T) {
+	s := collectionSettings{}
+	err := Unmarshal([]byte("[[server]]\nhost=a\nweight=2\n[[server]]\nhost=b\nweight=x"), &s)
+	var de *DecodeError
+	if !errors.As(err, &de) || len(de.Errors) != 1 || de.Errors[0].Field != "Servers[1].Weight" || de.Errors[0].Key != "server[1].weight" {
+		t.Errorf("The collection is not decoded with the errors: %v", err)
+	}
+	if len(s.Servers) != 2 || s.Servers[0].Host != "a" || s.Servers[0].Weight != 2 || s.Servers[1].Host != "b" {
+		t.Errorf("The collection is not decoded into the slice: %+v", s)
+	}
+
+	conf, err := FromStruct(collectionSettings{Servers: []collectionServer{{Host: "a", Weight: 2}, {Host: "b"}}})
+	if err != nil {
+		t.Errorf("Error building the collection from the structure: %v", err)
+		return
+	}
+	if str := conf.Marshal(); str != "server[0].host=a\nserver[0].weight=2\nserver[1].host=b\n" {
+		t.Errorf("The collection built from the structure is not correct:\n%s", str)
+	}
+}
+
+func TestFind(t *testing.T) {
+	conf := New()
+	err := conf.LoadString(`language.en.welcome=Welcome
+language.en.bye=Bye
+language.fr.welcome=Bienvenue
+feature.search=true
+feature.beta.chat=false
+feature.beta.voice=true
+title=${language.en.welcome}
+[[server]]
+host=alpha
+[[server]]
+host=beta
+`)
+	if err != nil {
+		t.Errorf("Error parsing the config: %v", err)
+		return
+	}
+	paths := func(entries []Entry) string {
+		p := []string{}
+		for _, e := range entries {
+			p = append(p, fmt.Sprintf("%s=%v", e.Path, e.Value))
+		}
+		return strings.Join(p, ",")
+	}
+	if s := paths(conf.Find("language.*.welcome")); s != "language.en.welcome=Welcome,language.fr.welcome=Bienvenue" {
+		t.Errorf("Find with * is not correct: %s", s)
+	}
+	entries := conf.Find("feature.**")
+	trues := []string{}
+	for _, e := range entries {
+		if e.Value == true {
+			trues = append(trues, e.Path)
+		}
+	}
+	if strings.Join(trues, ",") != "feature.search,feature.beta.voice" || len(entries) != 4 {
+		t.Errorf("Find with ** is not correct: %s", paths(entries))
+	}
+	if s := paths(conf.Find("**.voice")); s != "feature.beta.voice=true" {
+		t.Errorf("Find with ** at the beginning is not correct: %s", s)
+	}
+	if s := paths(conf.Find("server[*].host")); s != "server[0].host=alpha,server[1].host=beta" {
+		t.Errorf("Find into a collection is not correct: %s", s)
+	}
+	if s := paths(conf.Find("t*")); s != "title=Welcome" {
+		t.Errorf("Find with a glob is not correct: %s", s)
+	}
+	if s := paths(conf.Find("language.de.*")); s != "" {
+		t.Errorf("Find should not return anything: %s", s)
+	}
+	if s := paths(conf.Match(regexp.MustCompile(`^language\..*e$`))); s != "language.en.welcome=Welcome,language.en.bye=Bye,language.fr.welcome=Bienvenue" {
+		t.Errorf("Match is not correct: %s", s)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	conf := New()
+	err := conf.LoadString(`# comment
+name=app
+database.host=localhost
+database.options.ssl=true
+[[server]]
+host=alpha
+[[server]]
+host=${name}
+`)
+	if err != nil {
+		t.Errorf("Error parsing the config: %v", err)
+		return
+	}
+	paths := []string{}
+	err = conf.Walk(func(path string, p *Parameter) error {
+		paths = append(paths, path)
+		if path == "database.options" {
+			return SkipSubtree
+		}
+		return nil
+	})
+	if err != nil || strings.Join(paths, ",") != "name,database,database.host,database.options,server,server[0].host,server[1].host" {
+		t.Errorf("Walk is not correct: %v %v", paths, err)
+	}
+	stop := errors.New("stop")
+	count := 0
+	err = conf.Walk(func(path string, p *Parameter) error {
+		count++
+		if path == "database.host" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || count != 3 {
+		t.Errorf("Walk should stop on the error: %v %d", err, count)
+	}
+
+	if s := strings.Join(conf.Keys(), ","); s != "name,database,server" {
+		t.Errorf("Keys is not correct: %s", s)
+	}
+	if s := strings.Join(conf.FlatKeys(), ","); s != "name,database.host,database.options.ssl,server[0].host,server[1].host" {
+		t.Errorf("FlatKeys is not correct: %s", s)
+	}
+	m := conf.ToFlatMap()
+	if len(m) != 5 || m["database.options.ssl"] != true || m["server[1].host"] != "app" {
+		t.Errorf("ToFlatMap is not correct: %v", m)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	conf := New()
+	if err := conf.LoadFile("testunit/origin/global.conf"); err != nil {
+		t.Errorf("Error loading the global config: %v", err)
+		return
+	}
+	if err := conf.LoadFile("testunit/origin/local.conf"); err != nil {
+		t.Errorf("Error loading the local config: %v", err)
+		return
+	}
+	if err := conf.MergeString("list=d\nport:=9090\nport:=9091"); err != nil {
+		t.Errorf("Error merging the string: %v", err)
+		return
+	}
+	conf.Set("ip", "10.0.0.1")
+
+	origins, ok := conf.Origin("list")
+	if !ok || len(origins) != 2 || origins[0].String() != "load testunit/origin/local.conf:3" || origins[1].String() != "merge 1" {
+		t.Errorf("The origins of the array are not correct: %v", origins)
+	}
+	if origins, _ := conf.Origin("ip"); len(origins) != 1 || origins[0].Operation != "set" {
+		t.Errorf("The origin of a set value is not correct: %v", origins)
+	}
+	if _, ok := conf.Origin("nothere"); ok {
+		t.Errorf("The origin of a missing entry should not exist")
+	}
+
+	layers := []string{}
+	for _, l := range conf.Explain("port") {
+		layers = append(layers, l.String())
+	}
+	expected := "load testunit/origin/global.conf:2: 80 (overridden)," +
+		"load testunit/origin/local.conf:2: 8080 (overridden)," +
+		"merge 2: 9090 (overridden)," +
+		"merge 3: 9091"
+	if strings.Join(layers, ",") != expected {
+		t.Errorf("The explanation of the value is not correct:\n%s", strings.Join(layers, "\n"))
+	}
+	if l := conf.Explain("ip"); len(l) != 2 || !l[0].Overridden || l[1].Value != "10.0.0.1" {
+		t.Errorf("The explanation of a set value is not correct: %v", l)
+	}
+	// the values set by the program are not kept into the history
+	for i := 0; i < 100; i++ {
+		conf.Set("ip", "10.0.0.2")
+	}
+	if l := conf.Clone().(*XConfig).Explain("ip"); len(l) != 2 || !l[0].Overridden || l[0].Origin.Operation == "set" || l[1].Value != "10.0.0.2" {
+		t.Errorf("The history of the set values should not grow: %v", l)
+	}
+
+	// included files
+	inc := New()
+	if err := inc.LoadFile("testunit/include/main.conf"); err != nil {
+		t.Errorf("Error loading the includes: %v", err)
+		return
+	}
+	for _, path := range inc.FlatKeys() {
+		origins, _ := inc.Origin(path)
+		for _, o := range origins {
+			if o.Operation == "" || o.Line == 0 {
+				t.Errorf("The origin of %s is not set: %v", path, o)
+			}
+			if o.Operation == "@include" && !strings.HasPrefix(o.File, "testunit/include/") {
+				t.Errorf("The origin of the included %s is not the included file: %v", path, o)
+			}
+		}
+	}
+}
+
+func TestMergeOptions(t *testing.T) {
+	main := "database.user=admin\ndatabase.pass=none\nhosts=a\nhosts=b\nlanguage.en=Welcome\nlanguage.fr=Bienvenue\n"
+
+	// Load replaces the parameters of the sub XConfig one by one
+	conf := New()
+	conf.LoadString(main)
+	if err := conf.LoadString("database.pass=secret"); err != nil {
+		t.Errorf("Error loading the string: %v", err)
+		return
+	}
+	if user, _ := conf.GetString("database.user"); user != "admin" {
+		t.Errorf("The user of the database should be kept: %v", user)
+	}
+	if pass, _ := conf.GetString("database.pass"); pass != "secret" {
+		t.Errorf("The password of the database should be replaced: %v", pass)
+	}
+
+	conf = New()
+	conf.LoadString(main)
+	err := conf.MergeStringWith("database.pass=secret\nhosts=b\nhosts=c\nlanguage.es=Bienvenido\n", MergeOptions{
+		Mode: DeepReplace,
+		Rules: []MergeRule{
+			{Pattern: "hosts", Mode: AppendUnique},
+			{Pattern: "language", Mode: ShallowReplace},
+		},
+	})
+	if err != nil {
+		t.Errorf("Error merging the string: %v", err)
+		return
+	}
+	if user, _ := conf.GetString("database.user"); user != "admin" {
+		t.Errorf("The user of the database should be kept: %v", user)
+	}
+	if hosts, _ := conf.GetStringCollection("hosts"); !reflect.DeepEqual(hosts, []string{"a", "b", "c"}) {
+		t.Errorf("The hosts should be added once: %v", hosts)
+	}
+	if _, ok := conf.GetString("language.en"); ok {
+		t.Errorf("The language sub XConfig should be replaced as a whole")
+	}
+	if es, _ := conf.GetString("language.es"); es != "Bienvenido" {
+		t.Errorf("The new language should be loaded: %v", es)
+	}
+
+	// Append adds the values into the sub XConfig, += and := keep their behaviour
+	conf = New()
+	conf.LoadString(main)
+	other := New()
+	other.LoadString("database.user=guest\ndatabase.pass:=secret\n")
+	if err := conf.MergeXConfigWith(other, MergeOptions{Mode: Append}); err != nil {
+		t.Errorf("Error merging the XConfig: %v", err)
+		return
+	}
+	if users, _ := conf.GetStringCollection("database.user"); !reflect.DeepEqual(users, []string{"admin", "guest"}) {
+		t.Errorf("The users should be added: %v", users)
+	}
+	if pass, _ := conf.GetString("database.pass"); pass != "secret" {
+		t.Errorf("The password should be replaced by := : %v", pass)
+	}
+}
+
+func TestStack(t *testing.T) {
+	defaults := New()
+	defaults.LoadString("port=80\nhost=localhost\ndatabase.user=admin\ndatabase.pass=changeme\n")
+	local := New()
+	local.LoadString("port=8080\ndatabase.pass=secret\n")
+
+	stack := NewStack()
+	stack.Push("defaults", defaults)
+	stack.Push("local", local)
+	var _ xcore.XDatasetDef = stack
+
+	if port, ok := stack.GetInt("port"); !ok || port != 8080 {
+		t.Errorf("The port should come from the local layer: %v", port)
+	}
+	if _, layer, ok := stack.Lookup("host"); !ok || layer != "defaults" {
+		t.Errorf("The host should come from the defaults layer: %v", layer)
+	}
+	database, ok := stack.GetDataset("database")
+	if !ok {
+		t.Errorf("The database should be a dataset")
+		return
+	}
+	user, _ := database.GetString("user")
+	pass, _ := database.GetString("pass")
+	if user != "admin" || pass != "secret" {
+		t.Errorf("The database values are not correct: %v %v", user, pass)
+	}
+
+	// the layers are not copied
+	local.Set("host", "example.com")
+	if host, _ := stack.GetString("host"); host != "example.com" {
+		t.Errorf("The change into a layer should be seen by the stack: %v", host)
+	}
+	prod := New()
+	prod.LoadString("port=443\n")
+	if !stack.Replace("local", prod) {
+		t.Errorf("The local layer should be replaced")
+	}
+	if port, _, _ := stack.Lookup("port"); port != 443 {
+		t.Errorf("The port should come from the replaced layer: %v", port)
+	}
+	if !reflect.DeepEqual(stack.Layers(), []string{"defaults", "local"}) {
+		t.Errorf("The layers are not correct: %v", stack.Layers())
+	}
+	if flat := stack.Flatten(); flat.Marshal() != "port=443\nhost=localhost\ndatabase.user=admin\ndatabase.pass=changeme\n" {
+		t.Errorf("The flattened stack is not correct:\n%s", flat.Marshal())
+	}
+
+	// the references are resolved into the stack
+	base := New()
+	base.LoadString("basedir=/srv\nport=80\ndatabase.url=${basedir}/db:${port}\n")
+	top := New()
+	top.LoadString("logdir=${basedir}/logs\nport=${baseport}\nbaseport=8080\ndatabase.user=admin\n")
+	stack = NewStack(base, top)
+	if logdir, _ := stack.GetString("logdir"); logdir != "/srv/logs" {
+		t.Errorf("The reference to another layer is not resolved: %v", logdir)
+	}
+	if port, _ := stack.GetInt("port"); port != 8080 {
+		t.Errorf("The reference should keep the type of the value: %v", port)
+	}
+	if url, _, _ := stack.Lookup("database.url"); url != "/srv/db:8080" {
+		t.Errorf("The reference should take the value of the layer with the highest precedence: %v", url)
+	}
+	sub, ok := stack.Get("database")
+	if _, isstack := sub.(*Stack); !ok || !isstack {
+		t.Errorf("Get should return the sub XConfig of all the layers as GetDataset does: %#v", sub)
+		return
+	}
+	if url, _ := sub.(*Stack).GetString("url"); url != "/srv/db:8080" {
+		t.Errorf("The reference of a sub stack is not resolved: %v", url)
+	}
+	if user, _ := sub.(*Stack).GetString("user"); user != "admin" {
+		t.Errorf("The value of the sub stack is not correct: %v", user)
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	conf := New()
+	conf.LoadString("port=80\ndebug=no\nhosts=[a, b]\ndatabase.host=localhost\ndatabase.maxConnections=10\n")
+	t.Setenv("APP_PORT", "8080")
+	t.Setenv("APP_DEBUG", "yes")
+	t.Setenv("APP_HOSTS", "c, d, e")
+	t.Setenv("APP_DATABASE__HOST", "db.local")
+	t.Setenv("APP_DATABASE__MAXCONNECTIONS", "50")
+	t.Setenv("APP_TIMEOUT", "1.5")
+	t.Setenv("APPLICATION", "none")
+
+	if err := conf.LoadEnv("APP", EnvOptions{}); err != nil {
+		t.Errorf("Error loading the environment: %v", err)
+		return
+	}
+	if port, _ := conf.GetInt("port"); port != 8080 {
+		t.Errorf("The port should be loaded from the environment: %v", port)
+	}
+	if debug, _ := conf.GetBool("debug"); !debug {
+		t.Errorf("The debug flag should be loaded from the environment")
+	}
+	if hosts, _ := conf.GetStringCollection("hosts"); !reflect.DeepEqual(hosts, []string{"c", "d", "e"}) {
+		t.Errorf("The hosts should be split: %v", hosts)
+	}
+	if host, _ := conf.GetString("database.host"); host != "db.local" {
+		t.Errorf("The database host should be loaded from the environment: %v", host)
+	}
+	if max, _ := conf.GetInt("database.maxConnections"); max != 50 {
+		t.Errorf("The key should be matched without case: %v", max)
+	}
+	if timeout, _ := conf.GetFloat("timeout"); timeout != 1.5 {
+		t.Errorf("A new key should be created: %v", timeout)
+	}
+	if origins, _ := conf.Origin("port"); len(origins) != 1 || origins[0].String() != "env APP_PORT" {
+		t.Errorf("The origin of the value is not correct: %v", origins)
+	}
+
+	expected := []string{"APP_PORT", "APP_DEBUG", "APP_HOSTS", "APP_DATABASE__HOST", "APP_DATABASE__MAXCONNECTIONS", "APP_TIMEOUT"}
+	if doc := conf.EnvDoc("APP", EnvOptions{}); !reflect.DeepEqual(doc, expected) {
+		t.Errorf("The documentation of the variables is not correct: %v", doc)
+	}
+
+	strict := New()
+	strict.LoadString("port=80\n")
+	err := strict.LoadEnv("APP", EnvOptions{Strict: true})
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.File != "APP_DATABASE__HOST" {
+		t.Errorf("The strict mode should reject the unknown variables: %v", err)
+	}
+	if port, _ := strict.GetInt("port"); port != 80 {
+		t.Errorf("Nothing should be loaded in strict mode when a variable is rejected: %v", port)
+	}
+
+	// a variable cannot replace a sub XConfig or a collection
+	for _, name := range []string{"NODE_DATABASE", "NODE_SERVER", "NODE_SERVER__0"} {
+		node := New()
+		node.LoadString("port=80\ndatabase.host=localhost\n\n[[server]]\nhost=alpha\n")
+		t.Setenv("NODE_PORT", "8080")
+		t.Setenv(name, "oops")
+		err = node.LoadEnv("NODE", EnvOptions{})
+		if !errors.As(err, &perr) || perr.File != name {
+			t.Errorf("The variable %s should be rejected: %v", name, err)
+		}
+		if host, _ := node.GetString("database.host"); host != "localhost" {
+			t.Errorf("The sub XConfig should not be replaced by %s: %v", name, host)
+		}
+		if host, _ := node.GetString("server[0].host"); host != "alpha" {
+			t.Errorf("The collection should not be replaced by %s: %v", name, host)
+		}
+		if port, _ := node.GetInt("port"); port != 80 {
+			t.Errorf("Nothing should be loaded when %s is rejected: %v", name, port)
+		}
+		os.Unsetenv(name)
+	}
+
+	// the empty keys are rejected
+	for _, name := range []string{"EMPTY_A____B", "EMPTY_A__", "EMPTY___A"} {
+		empty := New()
+		empty.LoadString("port=80\n")
+		t.Setenv(name, "1")
+		err = empty.LoadEnv("EMPTY", EnvOptions{})
+		if !errors.As(err, &perr) || perr.File != name || empty.Marshal() != "port=80\n" {
+			t.Errorf("The variable %s with an empty key should be rejected: %v", name, err)
+		}
+		os.Unsetenv(name)
+	}
+
+	// an error while loading does not leave the XConfig half loaded
+	atomic := New()
+	atomic.LoadString("port=80\n")
+	t.Setenv("ATOM_A", "1")
+	t.Setenv("ATOM_PORT__X", "2")
+	if err := atomic.LoadEnv("ATOM", EnvOptions{}); !errors.As(err, &perr) || perr.File != "ATOM_PORT__X" {
+		t.Errorf("The variable under a value should be rejected: %v", err)
+	}
+	if _, ok := atomic.Get("a"); ok || atomic.Marshal() != "port=80\n" {
+		t.Errorf("Nothing should be loaded when a variable fails:\n%s", atomic.Marshal())
+	}
+}
+
+func TestFlags(t *testing.T) {
+	conf := New()
+	conf.LoadString("# the port of the server\nport=80\ndebug=no\nratio=1.5\nhosts=[a, b]\ndatabase.host=localhost\n\n[[server]]\nhost=alpha\n")
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.SetOutput(ioutil.Discard)
+	flags := conf.RegisterFlags(set)
+
+	if f := set.Lookup("port"); f == nil || f.Usage != "the port of the server" || f.DefValue != "80" {
+		t.Errorf("The port flag is not correct: %v", f)
+	}
+	if err := set.Parse([]string{"--port=8080", "--debug", "--ratio=2", "--hosts=c", "--hosts=d", "--server[0].host=beta"}); err != nil {
+		t.Errorf("Error parsing the flags: %v", err)
+		return
+	}
+	if err := flags.Apply(); err != nil {
+		t.Errorf("Error applying the flags: %v", err)
+		return
+	}
+	if port, _ := conf.GetInt("port"); port != 8080 {
+		t.Errorf("The port should be set by the flag: %v", port)
+	}
+	if debug, _ := conf.GetBool("debug"); !debug {
+		t.Errorf("The debug flag should be set")
+	}
+	if ratio, _ := conf.GetFloat("ratio"); ratio != 2 {
+		t.Errorf("The ratio should be a float: %v", ratio)
+	}
+	if hosts, _ := conf.GetStringCollection("hosts"); !reflect.DeepEqual(hosts, []string{"c", "d"}) {
+		t.Errorf("The repeated flags should replace the array: %v", hosts)
+	}
+	if host, _ := conf.GetString("database.host"); host != "localhost" {
+		t.Errorf("The flags not set should not change the values: %v", host)
+	}
+	if host, _ := conf.GetString("server[0].host"); host != "beta" {
+		t.Errorf("The flag of a collection should be set: %v", host)
+	}
+	if l := conf.Explain("port"); len(l) != 2 || l[1].Origin.String() != "flag --port" {
+		t.Errorf("The origin of the flag is not correct: %v", l)
+	}
+
+	set = flag.NewFlagSet("test", flag.ContinueOnError)
+	set.SetOutput(ioutil.Discard)
+	conf.RegisterFlags(set)
+	if err := set.Parse([]string{"--port=abc"}); err == nil {
+		t.Errorf("A value of the wrong type should be rejected")
+	}
+
+	// an error on a later flag does not leave the XConfig half loaded
+	atomic := New()
+	atomic.LoadString("port=80\nzone.name=eu\n")
+	set = flag.NewFlagSet("test", flag.ContinueOnError)
+	set.SetOutput(ioutil.Discard)
+	flags = atomic.RegisterFlags(set)
+	if err := set.Parse([]string{"--port=8080", "--zone.name=us"}); err != nil {
+		t.Errorf("Error parsing the flags: %v", err)
+		return
+	}
+	atomic.Set("zone", "none")
+	var perr *ParseError
+	if err := flags.Apply(); !errors.As(err, &perr) || perr.Key != "zone.name" {
+		t.Errorf("The flag under a value should fail: %v", err)
+	}
+	if port, _ := atomic.GetInt("port"); port != 80 {
+		t.Errorf("Nothing should be loaded when a flag fails: %v", port)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	conf := New()
+	if err := conf.LoadFileProfile("testunit/profile/app.conf", "prod"); err != nil {
+		t.Errorf("Error loading the profile: %v", err)
+		return
+	}
+	if port, _ := conf.GetInt("port"); port != 443 {
+		t.Errorf("The port of the profile should be loaded: %v", port)
+	}
+	if debug, _ := conf.GetBool("debug"); debug {
+		t.Errorf("The debug flag of the profile should be loaded")
+	}
+	if host, _ := conf.GetString("database.host"); host != "db.prod" {
+		t.Errorf("The block of the profile should be loaded: %v", host)
+	}
+	if hosts, _ := conf.GetStringCollection("hosts"); !reflect.DeepEqual(hosts, []string{"a", "b"}) {
+		t.Errorf("The new parameters of the profile should be loaded: %v", hosts)
+	}
+	if weight, _ := conf.GetInt("server[0].weight"); weight != 5 {
+		t.Errorf("The profile should be loaded into the collection: %v", weight)
+	}
+	if !reflect.DeepEqual(conf.Profiles(), []string{"prod", "staging"}) {
+		t.Errorf("The profiles are not correct: %v", conf.Profiles())
+	}
+	if l := conf.Explain("port"); len(l) != 2 || l[1].Origin.String() != "profile prod testunit/profile/app.conf:3" {
+		t.Errorf("The origin of the profile value is not correct: %v", l)
+	}
+
+	base := New()
+	base.LoadFile("testunit/profile/app.conf")
+	if port, _ := base.GetInt("port"); port != 80 {
+		t.Errorf("The profiles should be ignored without profile: %v", port)
+	}
+	if _, ok := base.Get("hosts"); ok {
+		t.Errorf("The blocks of the profiles should be ignored without profile")
+	}
+
+	// the overrides replace the values even when the file is merged
+	merged := New()
+	merged.LoadString("port=8080\nname=test\n")
+	if err := merged.MergeStringProfile("name=other\nport@prod=443", "prod"); err != nil {
+		t.Errorf("Error merging the profile: %v", err)
+		return
+	}
+	if port, _ := merged.GetInt("port"); port != 443 {
+		t.Errorf("The override should replace the merged value: %v", port)
+	}
+	if names, _ := merged.GetStringCollection("name"); !reflect.DeepEqual(names, []string{"test", "other"}) {
+		t.Errorf("The values should be merged: %v", names)
+	}
+
+	// the profiles are written back by Marshal, so they are loaded again
+	for _, opts := range []MarshalOptions{{}, {Sections: true}} {
+		data := conf.MarshalWith(opts)
+		if !strings.Contains(data, "port@prod=443") || !strings.Contains(data, "[profile:prod]\ndatabase.host=db.prod\nhosts=[a, b]") {
+			t.Errorf("The profiles should be written back:\n%s", data)
+		}
+		reloaded := New()
+		if err := reloaded.LoadString(data); err != nil {
+			t.Errorf("Error loading the marshaled profiles: %v", err)
+			return
+		}
+		host, _ := reloaded.GetString("database.host")
+		if port, _ := reloaded.GetInt("port"); port != 80 || host != "localhost" || !reflect.DeepEqual(reloaded.Profiles(), []string{"prod", "staging"}) {
+			t.Errorf("The marshaled string should be loaded as the file:\n%s", reloaded.Marshal())
+		}
+		reloaded = New()
+		if err := reloaded.LoadStringProfile(data, "prod"); err != nil {
+			t.Errorf("Error loading the marshaled profiles: %v", err)
+			return
+		}
+		port, _ := reloaded.GetInt("port")
+		host, _ = reloaded.GetString("database.host")
+		weight, _ := reloaded.GetInt("server[0].weight")
+		if hosts, _ := reloaded.GetStringCollection("hosts"); port != 443 || host != "db.prod" || weight != 5 || !reflect.DeepEqual(hosts, []string{"a", "b"}) {
+			t.Errorf("The marshaled profile should be loaded: %v %v %v %v", port, host, weight, hosts)
+		}
+	}
+}
+
+func TestUnset(t *testing.T) {
+	conf := New()
+	conf.LoadString("port=80\nhosts=[a, b, c]\ndatabase.user=admin\ndatabase.pass=none\ncache.host=localhost\ncache.port=11211\nname=test\n\n[[server]]\nhost=alpha\n\n[[server]]\nhost=beta\n")
+	err := conf.LoadString("!hosts=b\n!cache\n[database]\n!pass\n[]\n!server[0]\n!name=test\n!missing\nport=8080\n")
+	if err != nil {
+		t.Errorf("Error loading the overlay: %v", err)
+		return
+	}
+	if hosts, _ := conf.GetStringCollection("hosts"); !reflect.DeepEqual(hosts, []string{"a", "c"}) {
+		t.Errorf("The value should be removed from the array: %v", hosts)
+	}
+	if _, ok := conf.Get("cache"); ok {
+		t.Errorf("The sub XConfig should be deleted")
+	}
+	if _, ok := conf.Get("database.pass"); ok {
+		t.Errorf("The parameter of the section should be deleted")
+	}
+	if user, _ := conf.GetString("database.user"); user != "admin" {
+		t.Errorf("The other parameters of the section should be kept: %v", user)
+	}
+	if host, _ := conf.GetString("server[0].host"); host != "beta" {
+		t.Errorf("The element of the collection should be deleted: %v", host)
+	}
+	if _, ok := conf.Get("name"); ok {
+		t.Errorf("A parameter without its only value should be deleted")
+	}
+	if port, _ := conf.GetInt("port"); port != 8080 {
+		t.Errorf("The other values of the overlay should be loaded: %v", port)
+	}
+	if !reflect.DeepEqual(conf.Keys(), []string{"port", "hosts", "database", "server"}) {
+		t.Errorf("The order of the keys is not correct: %v", conf.Keys())
+	}
+
+	// into the same source, the directive deletes the values written before it
+	same := New()
+	same.LoadString("a=1\nb=2\n!a\n")
+	if _, ok := same.Get("a"); ok || !reflect.DeepEqual(same.Keys(), []string{"b"}) {
+		t.Errorf("The directive should delete the values of the same source: %v", same.Keys())
+	}
+	if err := same.LoadString("!\n"); err == nil {
+		t.Errorf("A directive without key should be an error")
+	}
+
+	// the directives of an included file apply on the including file
+	inc := New()
+	inc.LoadString("name=base\nversion=1\n")
+	if err := inc.LoadFile("testunit/unset/main.conf"); err != nil {
+		t.Errorf("Error loading the includes: %v", err)
+		return
+	}
+	if _, ok := inc.Get("name"); ok {
+		t.Errorf("The directive of the included file should delete the value of the including file")
+	}
+	if hosts, _ := inc.GetStringCollection("hosts"); !reflect.DeepEqual(hosts, []string{"b"}) {
+		t.Errorf("The directive of the included file should remove the value of the array: %v", hosts)
+	}
+	if port, _ := inc.GetInt("port"); port != 8080 || !reflect.DeepEqual(inc.Keys(), []string{"version", "port", "hosts"}) {
+		t.Errorf("The other values should be loaded: %v %v", port, inc.Keys())
+	}
+
+	// the directives of a merged string apply on the XConfig
+	merged := New()
+	merged.LoadString("a=1\nb=2\nhosts=[x, y]\n")
+	if err := merged.MergeStringWith("!a\n!hosts=x\nc=3\n", MergeOptions{Mode: DeepReplace}); err != nil {
+		t.Errorf("Error merging the string: %v", err)
+		return
+	}
+	if hosts, _ := merged.GetStringCollection("hosts"); merged.Marshal() != "b=2\nhosts=[y]\nc=3\n" || !reflect.DeepEqual(hosts, []string{"y"}) {
+		t.Errorf("The directives of the merged string should apply:\n%s", merged.Marshal())
+	}
+}